@@ -101,3 +101,55 @@ func BenchmarkLoggerNewFmtEncoderArgs(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkLoggerNewStreamJSONEncoderNoArgs(b *testing.B) {
+	logger := New(NewStreamJSONEncoder(DiscardWriter())).WithCxt("name", "bench")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			logger.Info("test")
+		}
+	})
+}
+
+func BenchmarkLoggerNewStreamJSONEncoderArgs(b *testing.B) {
+	logger := New(NewStreamJSONEncoder(DiscardWriter())).WithCxt("name", "bench")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			logger.Info("test", "key1", "value1", "key2", "value2")
+		}
+	})
+}
+
+func BenchmarkLoggerNewMsgpackEncoderArgs(b *testing.B) {
+	conf := MsgpackEncoderConfig{NoCaller: true}
+	logger := New(NewMsgpackEncoder(DiscardWriter(), conf)).WithCxt("name", "bench")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			logger.Info("test", "key1", "value1", "key2", "value2")
+		}
+	})
+}
+
+func BenchmarkLoggerNewAsyncEncoderTextJSONArgs(b *testing.B) {
+	conf := AsyncEncoderConfig{NoCaller: true}
+	encoder := NewAsyncEncoder(NewTextJSONEncoder(DiscardWriter()), conf)
+	defer encoder.Close()
+	logger := New(encoder).WithCxt("name", "bench")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			logger.Info("test", "key1", "value1", "key2", "value2")
+		}
+	})
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+func ExampleClockFunc() {
+	clock := ClockFunc(func() time.Time { return time.Date(2019, 5, 16, 17, 29, 12, 0, time.UTC) })
+
+	enc1 := NewTextJSONEncoder(os.Stdout, JSONEncoderConfig{TimeKey: "utctime"})
+	enc2 := NewStreamJSONEncoder(os.Stdout, JSONEncoderConfig{TimeLayout: TimeUnixMilli})
+	log := LoggerWithClock(New(MultiEncoder(enc1, enc2)), clock)
+	log.Info("frozen")
+
+	// Output:
+	// utctime=2019-05-16T17:29:12Z level=INFO msg=frozen
+	// {"time":1558027752000,"level":"INFO","name":"root","msg":"frozen"}
+}
+
+func TestNilClock(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := New(NewStreamJSONEncoder(buf))
+	LoggerWithClock(log, nil).Info("msg")
+	log.(ClockWither).WithClock(nil).Info("msg")
+	ToNoErrorLogger(log).(NoErrorClockWither).WithClock(nil).Info("msg")
+	if n := bytes.Count(buf.Bytes(), []byte("\n")); n != 3 {
+		t.Errorf("expect 3 logs, but got %d", n)
+	}
+}
+
+func TestDefaultClock(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := New(NewStreamJSONEncoder(buf, JSONEncoderConfig{TimeLayout: TimeUnixMilli}))
+	nilClock := LoggerWithClock(log, nil)
+
+	defer func(clock Clock) { DefaultClock = clock }(DefaultClock)
+	DefaultClock = ClockFunc(func() time.Time { return time.Unix(1558027752, 0) })
+
+	log.Info("msg")
+	nilClock.Info("msg")
+	if n := bytes.Count(buf.Bytes(), []byte(`"time":1558027752000,`)); n != 2 {
+		t.Errorf("DefaultClock does not take effect: %s", buf.String())
+	}
+}
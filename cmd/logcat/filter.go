@@ -0,0 +1,119 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xgfone/logger"
+	"github.com/xgfone/logger/parse"
+)
+
+// filter decides whether to output the log record.
+type filter struct {
+	Level    logger.Level
+	HasLevel bool
+	Name     string
+	Since    time.Time
+	Until    time.Time
+	Fields   []parse.Field // The values are the strings.
+}
+
+// IsEmpty reports whether the filter has no condition.
+func (f filter) IsEmpty() bool {
+	return !f.HasLevel && f.Name == "" && f.Since.IsZero() && f.Until.IsZero() &&
+		len(f.Fields) == 0
+}
+
+// Match reports whether the log record matches all the conditions.
+func (f filter) Match(r parse.Record) bool {
+	if f.HasLevel && (!r.HasLevel || r.Level < f.Level) {
+		return false
+	}
+	if f.Name != "" {
+		if ok, _ := path.Match(f.Name, r.Name); !ok {
+			return false
+		}
+	}
+	if !f.Since.IsZero() && r.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && r.Time.After(f.Until) {
+		return false
+	}
+
+	for _, _f := range f.Fields {
+		v, ok := r.Lookup(_f.Key)
+		if !ok || toString(v) != _f.Value.(string) {
+			return false
+		}
+	}
+	return true
+}
+
+func toString(v interface{}) string {
+	switch _v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return _v
+	case json.Number:
+		return _v.String()
+	case bool:
+		return strconv.FormatBool(_v)
+	default:
+		return string(parse.AppendJSON(nil, v))
+	}
+}
+
+// parseTimeFlag parses the time from the flag value, which may be
+// the RFC3339 time, or the duration before now, such as "1h30m".
+func parseTimeFlag(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s'", s)
+}
+
+// fieldsFlag is the repeatable flag "key=value".
+type fieldsFlag []parse.Field
+
+func (f *fieldsFlag) String() string {
+	ss := make([]string, len(*f))
+	for i, _f := range *f {
+		ss[i] = fmt.Sprintf("%s=%s", _f.Key, _f.Value)
+	}
+	return strings.Join(ss, ",")
+}
+
+func (f *fieldsFlag) Set(s string) error {
+	index := strings.IndexByte(s, '=')
+	if index < 1 {
+		return fmt.Errorf("the field filter must be 'key=value'")
+	}
+	*f = append(*f, parse.Field{Key: s[:index], Value: s[index+1:]})
+	return nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"time"
+)
+
+// lineReader reads the log lines one by one.
+type lineReader interface {
+	ReadLine() (string, error)
+}
+
+type stdinReader struct {
+	r *bufio.Reader
+}
+
+func (r stdinReader) ReadLine() (string, error) {
+	line, err := r.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return line, err
+}
+
+// fileReader reads the lines from the file. If follow is true, it waits for
+// the new lines at the end of the file like "tail -F", and reopens the file
+// when it has been rotated, such as renamed by SizedRotatingFileWriter,
+// or truncated.
+type fileReader struct {
+	path     string
+	follow   bool
+	interval time.Duration
+
+	file     *os.File
+	reader   *bufio.Reader
+	offset   int64
+	partial  string
+	draining bool
+}
+
+func openFileReader(path string, follow bool) (*fileReader, error) {
+	r := &fileReader{path: path, follow: follow, interval: time.Millisecond * 200}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *fileReader) open() error {
+	file, err := os.Open(r.path)
+	if err != nil {
+		return err
+	}
+
+	if r.file != nil {
+		r.file.Close()
+	}
+	r.file = file
+	r.reader = bufio.NewReader(file)
+	r.offset = 0
+	return nil
+}
+
+func (r *fileReader) Close() error {
+	return r.file.Close()
+}
+
+func (r *fileReader) ReadLine() (string, error) {
+	for {
+		line, err := r.reader.ReadString('\n')
+		r.offset += int64(len(line))
+		if err == nil {
+			line, r.partial = r.partial+line, ""
+			return line, nil
+		} else if err != io.EOF {
+			return "", err
+		}
+
+		r.partial += line
+		if !r.follow {
+			if r.partial != "" {
+				line, r.partial = r.partial, ""
+				return line, nil
+			}
+			return "", io.EOF
+		}
+
+		// The old file has been drained after rotated, so switch to the new.
+		if r.draining {
+			if err = r.open(); err != nil {
+				if os.IsNotExist(err) {
+					time.Sleep(r.interval)
+					continue
+				}
+				return "", err
+			}
+
+			r.draining = false
+			if r.partial != "" {
+				line, r.partial = r.partial, ""
+				return line, nil
+			}
+			continue
+		}
+
+		rotated, err := r.checkRotation()
+		if err != nil {
+			return "", err
+		} else if !rotated {
+			time.Sleep(r.interval)
+		}
+	}
+}
+
+// checkRotation reports whether the file has been rotated or truncated.
+func (r *fileReader) checkRotation() (bool, error) {
+	newInfo, err := os.Stat(r.path)
+	if err != nil {
+		if os.IsNotExist(err) { // The file is being rotated.
+			return false, nil
+		}
+		return false, err
+	}
+
+	oldInfo, err := r.file.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	if !os.SameFile(oldInfo, newInfo) {
+		// Read the rest lines of the old file before switching to the new.
+		r.draining = true
+		return true, nil
+	}
+
+	if newInfo.Size() < r.offset {
+		if _, err = r.file.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		r.reader.Reset(r.file)
+		r.offset = 0
+		r.partial = ""
+		return true, nil
+	}
+
+	return false, nil
+}
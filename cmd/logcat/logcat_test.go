@@ -0,0 +1,118 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xgfone/logger"
+	"github.com/xgfone/logger/parse"
+)
+
+func TestFilter(t *testing.T) {
+	lines := []string{
+		`{"time":"2019-05-16T17:29:12Z","level":"ERROR","name":"http","msg":"request","http":{"method":"GET","status":500},"cost":1.5}`,
+		`time=2019-05-16T17:29:12Z level=ERROR name=http http.method=GET http.status=500 cost=1.5 msg=request`,
+	}
+
+	p := parse.MultiParser(parse.NewJSONParser(), parse.NewTextParser())
+	f := filter{Level: logger.LvlWarn, HasLevel: true, Name: "ht*",
+		Since:  time.Date(2019, 5, 16, 17, 0, 0, 0, time.UTC),
+		Fields: []parse.Field{{Key: "http.method", Value: "GET"}, {Key: "http.status", Value: "500"}}}
+
+	for _, line := range lines {
+		r, err := p.Parse(line)
+		if err != nil {
+			t.Fatal(err)
+		} else if !f.Match(r) {
+			t.Errorf("expect the record to match the filter: %+v", r)
+		}
+
+		f.Level = logger.LvlFatal
+		if f.Match(r) {
+			t.Errorf("expect the record not to match the filter: %+v", r)
+		}
+		f.Level = logger.LvlWarn
+	}
+}
+
+func TestJSONPrinter(t *testing.T) {
+	line := `{"time":"2019-05-16T17:29:12Z","level":"INFO","msg":"test","caller":"main.go:1","b":1,"a":{"c":[1,"x"]}}`
+	r, err := parse.NewJSONParser().Parse(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caller := extractCaller(&r, "caller")
+
+	buf := bytes.NewBuffer(nil)
+	(&jsonPrinter{w: buf}).Print(r, caller)
+	(&jsonPrinter{w: buf, keys: []string{"a.c"}}).Print(r, "")
+
+	expected := `{"time":"2019-05-16T17:29:12Z","level":"INFO","msg":"test","caller":"main.go:1","b":1,"a":{"c":[1,"x"]}}` + "\n" +
+		`{"time":"2019-05-16T17:29:12Z","level":"INFO","msg":"test","a.c":[1,"x"]}` + "\n" +
+		`{"msg":"no time"}` + "\n"
+
+	if r, err = parse.NewJSONParser().Parse(`{"msg":"no time"}`); err != nil {
+		t.Fatal(err)
+	}
+	(&jsonPrinter{w: buf}).Print(r, "")
+	if buf.String() != expected {
+		t.Errorf("expected '%s', but got '%s'", expected, buf.String())
+	}
+}
+
+func TestFileReaderFollowRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logcat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	w, c, err := logger.SizedRotatingFileWriter(path, 20, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	r, err := openFileReader(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.interval = time.Millisecond
+
+	lines := []string{"line1 1234567890\n", "line2 1234567890\n", "line3 1234567890\n"}
+	go func() {
+		for _, line := range lines {
+			w.Write([]byte(line))
+			time.Sleep(time.Millisecond * 10)
+		}
+	}()
+
+	for _, expected := range lines {
+		line, err := r.ReadLine()
+		if err != nil {
+			t.Fatal(err)
+		} else if line != expected {
+			t.Errorf("expected '%s', but got '%s'", expected, line)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command logcat reads the logs produced by NewStdJSONEncoder,
+// NewSimpleJSONEncoder, NewStreamJSONEncoder, NewTextJSONEncoder or
+// NewFmtEncoder from the files or stdin, filters them, and renders them
+// with the colored console layout or outputs them as NDJSON.
+//
+// Usage:
+//
+//     logcat [flags] [file ...]
+//
+// For example,
+//
+//     # Show the logs whose level is WARN or higher in the last hour.
+//     logcat -level warn -since 1h app.log
+//
+//     # Follow the log file across the rotations, like "tail -F".
+//     logcat -f -name 'http.*' -field status=500 app.log
+//
+//     # Output the subset of the fields as NDJSON.
+//     logcat -json -keys method,path app.log.2 app.log.1 app.log
+//
+//     # Read the logs produced by NewFmtEncoder with the template.
+//     logcat -fmt '{time} [{level}] {caller}: {msg}' app.log
+//
+// The lines which are not the logs are output as they are only if rendering
+// with the console layout and no filter is given.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/xgfone/logger"
+	"github.com/xgfone/logger/parse"
+)
+
+var (
+	level   = flag.String("level", "", "Only output the logs whose level is not less than it.")
+	name    = flag.String("name", "", "Only output the logs whose logger name matches the glob pattern.")
+	since   = flag.String("since", "", "Only output the logs not before the time, which is RFC3339 or the duration before now, such as 1h.")
+	until   = flag.String("until", "", "Only output the logs not after the time, which is RFC3339 or the duration before now.")
+	follow  = flag.Bool("f", false, "Follow the files across the rotations, like 'tail -F'.")
+	asJSON  = flag.Bool("json", false, "Output the logs as NDJSON instead of the console layout.")
+	onlyKey = flag.String("keys", "", "The comma-separated keys of the fields output by -json, which may be dotted. Default all.")
+	color   = flag.String("color", "auto", "Color the console output: auto, always or never.")
+	layout  = flag.String("time-layout", "2006-01-02 15:04:05.000", "The layout of the time in the console layout.")
+
+	tmpl      = flag.String("fmt", "", "The template of NewFmtEncoder to parse the logs. If empty, parse the logs as JSON or text.")
+	timeKey   = flag.String("time-key", "time", "The key of the time.")
+	timeFmt   = flag.String("time-format", "", "The layout of the time in the logs, which may be unix, unixmilli or unixnano. Default RFC3339Nano.")
+	levelKey  = flag.String("level-key", "level", "The key of the level.")
+	nameKey   = flag.String("name-key", "name", "The key of the logger name.")
+	msgKey    = flag.String("msg-key", "msg", "The key of the message.")
+	callerKey = flag.String("caller-key", "caller", "The key of the caller.")
+
+	fields fieldsFlag
+)
+
+func main() {
+	flag.Var(&fields, "field", "Only output the logs whose field equals to the value, such as 'key=value'. It may be given more than once.")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [file ...]\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "logcat: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(files []string) (err error) {
+	f, err := newFilter()
+	if err != nil {
+		return
+	}
+	p, err := newParser()
+	if err != nil {
+		return
+	}
+
+	// Every log is written by a single call of Write, so don't buffer it.
+	var out printer
+	if *asJSON {
+		out = &jsonPrinter{w: os.Stdout, keys: splitKeys(*onlyKey)}
+	} else {
+		var mode logger.ColorMode
+		switch *color {
+		case "auto":
+			mode = logger.ColorAuto
+		case "always":
+			mode = logger.ColorAlways
+		case "never":
+			mode = logger.ColorNever
+		default:
+			return fmt.Errorf("invalid color mode '%s'", *color)
+		}
+		out = newConsolePrinter(os.Stdout, mode, *layout)
+	}
+
+	raw := !*asJSON && f.IsEmpty()
+	handle := func(line string) error {
+		r, err := p.Parse(line)
+		if err != nil {
+			if raw {
+				return out.PrintRaw(strings.TrimRight(line, "\r\n"))
+			}
+			return nil
+		} else if f.Match(r) {
+			return out.Print(r, extractCaller(&r, *callerKey))
+		}
+		return nil
+	}
+
+	var readers []lineReader
+	if len(files) == 0 {
+		readers = append(readers, stdinReader{bufio.NewReader(os.Stdin)})
+	} else {
+		for _, file := range files {
+			r, err := openFileReader(file, *follow)
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			readers = append(readers, r)
+		}
+	}
+
+	if *follow && len(readers) > 1 {
+		return readConcurrently(readers, handle)
+	}
+
+	for _, r := range readers {
+		for {
+			line, err := r.ReadLine()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			} else if err = handle(line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readConcurrently follows all the files at the same time.
+func readConcurrently(readers []lineReader, handle func(string) error) error {
+	lines := make(chan string, 64)
+	errs := make(chan error, len(readers))
+	for _, r := range readers {
+		go func(r lineReader) {
+			for {
+				line, err := r.ReadLine()
+				if err != nil {
+					errs <- err
+					return
+				}
+				lines <- line
+			}
+		}(r)
+	}
+
+	for {
+		select {
+		case line := <-lines:
+			if err := handle(line); err != nil {
+				return err
+			}
+		case err := <-errs:
+			return err
+		}
+	}
+}
+
+func newParser() (parse.Parser, error) {
+	if *tmpl != "" {
+		return parse.NewFmtParser(logger.FmtEncoderConfig{Tmpl: *tmpl, TimeLayout: *timeFmt})
+	}
+
+	conf := logger.JSONEncoderConfig{
+		TimeKey:    *timeKey,
+		TimeLayout: *timeFmt,
+		LevelKey:   *levelKey,
+		NameKey:    *nameKey,
+		MsgKey:     *msgKey,
+	}
+	return parse.MultiParser(parse.NewJSONParser(conf), parse.NewTextParser(conf)), nil
+}
+
+// extractCaller removes the caller from the fields of the record,
+// and returns it.
+func extractCaller(r *parse.Record, key string) string {
+	for i, f := range r.Fields {
+		if f.Key == key {
+			r.Fields = append(r.Fields[:i], r.Fields[i+1:]...)
+			return toString(f.Value)
+		}
+	}
+	return ""
+}
+
+func splitKeys(s string) []string {
+	var ks []string
+	for _, k := range strings.Split(s, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			ks = append(ks, k)
+		}
+	}
+	return ks
+}
+
+func newFilter() (f filter, err error) {
+	if *level != "" {
+		if f.Level, f.HasLevel = parse.NameToLevel(*level); !f.HasLevel {
+			return f, fmt.Errorf("invalid level '%s'", *level)
+		}
+	}
+
+	now := time.Now()
+	if f.Since, err = parseTimeFlag(*since, now); err != nil {
+		return
+	}
+	if f.Until, err = parseTimeFlag(*until, now); err != nil {
+		return
+	}
+
+	f.Name = *name
+	f.Fields = fields
+	return
+}
@@ -0,0 +1,109 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io"
+	"time"
+
+	"github.com/xgfone/logger"
+	"github.com/xgfone/logger/parse"
+)
+
+// printer outputs the log entries.
+type printer interface {
+	Print(r parse.Record, caller string) error
+	PrintRaw(line string) error
+}
+
+// consolePrinter renders the log entries by the console encoder.
+type consolePrinter struct {
+	enc    logger.Encoder
+	caller string
+}
+
+func newConsolePrinter(w io.Writer, color logger.ColorMode, layout string) *consolePrinter {
+	p := &consolePrinter{}
+	p.enc = logger.NewConsoleEncoder(w, logger.ConsoleEncoderConfig{
+		Color:      color,
+		TimeLayout: layout,
+		Valuers: map[string]logger.Valuer{
+			"caller": func(logger.Record) (interface{}, error) { return p.caller, nil },
+			"time":   parse.TimeValuer(layout),
+		},
+	})
+	return p
+}
+
+func (p *consolePrinter) Print(r parse.Record, caller string) error {
+	p.caller = caller
+	return r.Encode(p.enc)
+}
+
+func (p *consolePrinter) PrintRaw(line string) error {
+	_, err := io.WriteString(p.enc.Writer(), line+"\n")
+	return err
+}
+
+// jsonPrinter outputs the log entries as NDJSON.
+type jsonPrinter struct {
+	w    io.Writer
+	keys []string
+	buf  []byte
+}
+
+func (p *jsonPrinter) Print(r parse.Record, caller string) error {
+	p.buf = append(p.buf[:0], '{')
+	if !r.Time.IsZero() {
+		p.buf = appendJSONField(p.buf, "time", r.Time.Format(time.RFC3339Nano))
+	}
+	if r.HasLevel {
+		p.buf = appendJSONField(p.buf, "level", r.Level.String())
+	}
+	if r.Name != "" {
+		p.buf = appendJSONField(p.buf, "name", r.Name)
+	}
+	p.buf = appendJSONField(p.buf, "msg", r.Msg)
+	if caller != "" {
+		p.buf = appendJSONField(p.buf, "caller", caller)
+	}
+
+	if len(p.keys) == 0 {
+		for _, f := range r.Fields {
+			p.buf = appendJSONField(p.buf, f.Key, f.Value)
+		}
+	} else {
+		for _, key := range p.keys {
+			if v, ok := r.Lookup(key); ok {
+				p.buf = appendJSONField(p.buf, key, v)
+			}
+		}
+	}
+
+	p.buf = append(p.buf, '}', '\n')
+	_, err := p.w.Write(p.buf)
+	return err
+}
+
+func (p *jsonPrinter) PrintRaw(line string) error { return nil }
+
+func appendJSONField(buf []byte, key string, value interface{}) []byte {
+	if len(buf) > 1 {
+		buf = append(buf, ',')
+	}
+	buf = parse.AppendJSON(buf, key)
+	buf = append(buf, ':')
+	return parse.AppendJSON(buf, value)
+}
@@ -51,6 +51,8 @@
 //   FileWriter   ChannelWriter   LevelFilterWriter
 //   SafeWriter   DiscardWriter   SyslogNetWriter
 //   MultiWriter  BufferedWriter  FailoverWriter
+//   TimedRotatingFileWriter  SignalReopenFileWriter  BufferedFileWriter
+//   AsyncWriter  BatchWriter  ResilientNetWriter  HTTPWriter  LokiWriter
 //
 // Performance
 //
@@ -0,0 +1,321 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrAsyncEncoderTimeout is returned when the async encoder fails to encode
+// the queued records in time.
+var ErrAsyncEncoderTimeout = errors.New("timeout to drain the async encoder")
+
+// AsyncEncoderConfig is used to configure the async encoder.
+type AsyncEncoderConfig struct {
+	// The number of the workers, which is runtime.GOMAXPROCS(0) by default.
+	Workers int
+
+	// The maximum number of the records in the queue of each worker,
+	// which is 1024 by default.
+	QueueSize int
+
+	// If true, drop the record when the queue is full. Or, block until
+	// the queue is not full.
+	DropWhenFull bool
+
+	// The timeout for Flush and Close to wait for the queued records to be
+	// encoded, which is 10s by default.
+	DrainTimeout time.Duration
+
+	// If not nil, it is called with the error returned by the wrapped encoder.
+	ErrorHandler func(Record, error)
+
+	// If true, the caller won't be captured, which is expensive. It should be
+	// set only if neither the wrapped encoder nor the valuers use the caller.
+	NoCaller bool
+}
+
+// AsyncEncoder is an encoder which encodes the records by the wrapped encoder
+// in the background workers, so the expensive encoding and writing are moved
+// off the goroutine emitting the log.
+//
+// Before queuing the record, it captures synchronously what cannot be deferred,
+// that's, the caller, the time, and the copies of the arguments and
+// the contexts, the Valuers in which are evaluated, including those
+// in the nested Group. So the mutable values in them, such as the map and
+// the pointer, should not be modified after emitting the log.
+//
+// The records of the loggers with the same name are always encoded by the same
+// worker, so the order of them is preserved. But the records of the different
+// loggers may be written concurrently, so the underlying writer must be
+// thread-safe.
+//
+// The records of LvlPanic and LvlFatal are encoded synchronously after
+// the queued records are encoded, because the program may exit immediately.
+//
+// Notice: the valuers configured in the wrapped encoder, which get the caller
+// stack by themselves, such as CallerStack, cannot work. Caller works well
+// because the caller has been captured.
+type AsyncEncoder struct {
+	dropped uint64
+	failed  uint64
+
+	// Protect closed, so that Close waits for the in-flight Encode calls
+	// queuing the records.
+	state  sync.RWMutex
+	closed bool
+
+	lock sync.RWMutex // Protect the wrapped encoder from ResetWriter.
+	enc  Encoder
+	conf AsyncEncoderConfig
+
+	workers []asyncWorker
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+type asyncWorker struct {
+	queue   chan Record
+	counter *asyncCounter
+}
+
+// NewAsyncEncoder returns a new AsyncEncoder wrapping the encoder enc.
+func NewAsyncEncoder(enc Encoder, conf ...AsyncEncoderConfig) *AsyncEncoder {
+	var c AsyncEncoderConfig
+	if len(conf) > 0 {
+		c = conf[0]
+	}
+	if c.Workers <= 0 {
+		c.Workers = runtime.GOMAXPROCS(0)
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = 1024
+	}
+	if c.DrainTimeout <= 0 {
+		c.DrainTimeout = time.Second * 10
+	}
+
+	e := &AsyncEncoder{
+		enc:     enc,
+		conf:    c,
+		workers: make([]asyncWorker, c.Workers),
+		done:    make(chan struct{}),
+	}
+
+	e.wg.Add(c.Workers)
+	for i := range e.workers {
+		e.workers[i] = asyncWorker{
+			queue:   make(chan Record, c.QueueSize),
+			counter: newAsyncCounter(),
+		}
+		go e.loop(e.workers[i])
+	}
+	return e
+}
+
+// Dropped returns the number of the records dropped because the queue is full.
+func (e *AsyncEncoder) Dropped() uint64 {
+	return atomic.LoadUint64(&e.dropped)
+}
+
+// Failed returns the number of the records which failed to be encoded
+// in the background.
+func (e *AsyncEncoder) Failed() uint64 {
+	return atomic.LoadUint64(&e.failed)
+}
+
+// Writer implements the interface Encoder.
+func (e *AsyncEncoder) Writer() Writer {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return e.enc.Writer()
+}
+
+// ResetWriter implements the interface Encoder.
+//
+// The queued records may be written into the new writer.
+func (e *AsyncEncoder) ResetWriter(w Writer) {
+	e.lock.Lock()
+	e.enc.ResetWriter(w)
+	e.lock.Unlock()
+}
+
+// Encode implements the interface Encoder.
+//
+// It returns the error only if it fails to capture the record,
+// or the record is encoded synchronously. If the encoder has been closed,
+// the record is encoded synchronously.
+func (e *AsyncEncoder) Encode(r Record) (err error) {
+	// getCaller skips itself and one more frame, which is Encode here,
+	// so it must be called before increasing the depth.
+	if !e.conf.NoCaller {
+		r.getCaller()
+	}
+	r.Depth++
+
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	if r.Ctxs, err = snapshotKVs(r, r.Ctxs); err != nil {
+		return
+	}
+	if r.Args, err = snapshotKVs(r, r.Args); err != nil {
+		return
+	}
+
+	e.state.RLock()
+	if closed := e.closed; closed || r.Lvl >= LvlPanic {
+		e.state.RUnlock()
+		if !closed {
+			e.Flush()
+		}
+		e.lock.RLock()
+		defer e.lock.RUnlock()
+		return e.enc.Encode(r)
+	}
+	defer e.state.RUnlock()
+
+	worker := e.workers[fnv32a(r.Name)%uint32(len(e.workers))]
+
+	put := func() bool {
+		select {
+		case worker.queue <- r:
+			return true
+		default:
+			return false
+		}
+	}
+
+	if e.conf.DropWhenFull {
+		if !worker.counter.Enqueue(put) {
+			atomic.AddUint64(&e.dropped, 1)
+		}
+		return
+	}
+
+	worker.counter.EnqueueWait(put, nil, nil)
+	return
+}
+
+// fnv32a returns the 32-bit FNV-1a hash of s like hash/fnv,
+// but doesn't allocate.
+func fnv32a(s string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= 16777619
+	}
+	return h
+}
+
+func (e *AsyncEncoder) loop(w asyncWorker) {
+	defer e.wg.Done()
+	for {
+		select {
+		case r := <-w.queue:
+			e.encode(r)
+			w.counter.Done()
+		case <-e.done:
+			return
+		}
+	}
+}
+
+func (e *AsyncEncoder) encode(r Record) {
+	e.lock.RLock()
+	err := e.enc.Encode(r)
+	e.lock.RUnlock()
+
+	if err != nil {
+		atomic.AddUint64(&e.failed, 1)
+		if e.conf.ErrorHandler != nil {
+			e.conf.ErrorHandler(r, err)
+		}
+	}
+}
+
+// Flush waits until all the records queued before calling it are encoded.
+//
+// It returns ErrAsyncEncoderTimeout if the records are not encoded
+// in conf.DrainTimeout.
+func (e *AsyncEncoder) Flush() error {
+	timer := time.NewTimer(e.conf.DrainTimeout)
+	defer timer.Stop()
+
+	for _, w := range e.workers {
+		if !w.counter.Wait(w.counter.Target(), timer.C) {
+			return ErrAsyncEncoderTimeout
+		}
+	}
+	return nil
+}
+
+// Close waits until the queued records are encoded, then stops the workers.
+// After that, the records are encoded synchronously.
+//
+// It does not close the underlying writer.
+func (e *AsyncEncoder) Close() (err error) {
+	// Wait for the in-flight Encode calls, so no record is queued after it.
+	e.state.Lock()
+	closed := e.closed
+	e.closed = true
+	e.state.Unlock()
+	if closed {
+		return nil
+	}
+
+	err = e.Flush()
+	close(e.done)
+	if err == nil {
+		e.wg.Wait()
+	}
+	return
+}
+
+// snapshotKVs returns the copy of the key-value pairs, the Valuers in which
+// are evaluated, including those in the nested Group.
+func snapshotKVs(r Record, kvs []interface{}) (_ []interface{}, err error) {
+	if len(kvs) == 0 {
+		return kvs, nil
+	}
+
+	r.Depth++
+	values := make([]interface{}, len(kvs))
+	for i, _len := 0, len(kvs); i < _len; i++ {
+		if _, ok := kvs[i].(groupKey); ok && i+1 < _len {
+			values[i], values[i+1] = kvs[i], kvs[i+1]
+			i++
+			continue
+		}
+
+		var v interface{}
+		if v, err = MayBeValuer(r, kvs[i]); err != nil {
+			return
+		}
+		if g, ok := v.(Group); ok {
+			var group []interface{}
+			if group, err = snapshotKVs(r, g); err != nil {
+				return
+			}
+			v = Group(group)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func ExampleNewAsyncEncoder() {
+	conf := FmtEncoderConfig{Tmpl: "{filename}:{lineno} {ctx} [{level}]: {msg}"}
+	encoder := NewAsyncEncoder(NewFmtEncoder(os.Stdout, conf))
+	defer encoder.Close()
+
+	var count int
+	counter := func(r Record) (interface{}, error) { count++; return count, nil }
+	log := New(encoder).WithCxt("caller", Caller(), "count", counter)
+
+	log.Info("test %s", "async")
+	log.Info("test %s", "encoder")
+	encoder.Flush()
+
+	// Output:
+	// encoder_async_test.go:37 caller|encoder_async_test.go:37|count|1 [INFO]: test async
+	// encoder_async_test.go:38 caller|encoder_async_test.go:38|count|2 [INFO]: test encoder
+}
+
+func TestAsyncEncoder(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	encoder := NewAsyncEncoder(NewTextJSONEncoder(SafeWriter(buf)),
+		AsyncEncoderConfig{Workers: 4})
+	log := New(encoder)
+
+	var expects []string
+	for i := 0; i < 100; i++ {
+		args := []interface{}{"key", i, "group", Group{"value", func(r Record) (interface{}, error) { return i, nil }}}
+		log.WithName(fmt.Sprintf("log%d", i%3)).Info("msg", args...)
+		args[1] = -1 // The arguments have been snapshot.
+		expects = append(expects, fmt.Sprintf("key=%d group.value=%d msg=msg", i, i))
+	}
+	encoder.Close()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(expects) {
+		t.Fatalf("expect %d lines, but got %d", len(expects), len(lines))
+	}
+
+	// The order of the records of each logger is preserved.
+	indexes := make(map[string]int)
+	for _, line := range lines {
+		if index := strings.Index(line, " key="); index > -1 {
+			line = line[index+1:]
+		}
+		var key, value int
+		fmt.Sscanf(line, "key=%d group.value=%d", &key, &value)
+		name := fmt.Sprintf("log%d", key%3)
+		if key < indexes[name] || line != expects[key] {
+			t.Errorf("unexpected line: %s", line)
+		}
+		indexes[name] = key
+	}
+}
+
+func TestAsyncEncoderCloseConcurrently(t *testing.T) {
+	var encoded uint64
+	enc := EncoderFunc(DiscardWriter(), func(w Writer, r Record) error {
+		atomic.AddUint64(&encoded, 1)
+		return nil
+	})
+	encoder := NewAsyncEncoder(enc, AsyncEncoderConfig{QueueSize: 4, DropWhenFull: true})
+	log := New(encoder)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				log.WithName(name).Info("msg")
+			}
+		}(fmt.Sprintf("log%d", i))
+	}
+	encoder.Close()
+	wg.Wait()
+
+	// No record is lost without being counted.
+	if total := atomic.LoadUint64(&encoded) + encoder.Dropped(); total != 800 {
+		t.Errorf("expect 800 records, but got %d", total)
+	}
+}
+
+func TestFnv32a(t *testing.T) {
+	for _, s := range []string{"", "a", "root", "http.server"} {
+		h := fnv.New32a()
+		h.Write([]byte(s))
+		if v := fnv32a(s); v != h.Sum32() {
+			t.Errorf("%q: expect %d, but got %d", s, h.Sum32(), v)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/xgfone/go-tools/json2"
+)
+
+// ColorMode is the mode to decide whether to color the output.
+type ColorMode int
+
+// Predefine some color modes.
+const (
+	// ColorAuto colors the output only if the writer is a terminal.
+	//
+	// But the environment variable NO_COLOR disables it if it is set to
+	// a non-empty value, and FORCE_COLOR enables it if it is set to
+	// a non-empty value except "0" and "false". NO_COLOR has the higher priority.
+	ColorAuto ColorMode = iota
+
+	// ColorAlways always colors the output.
+	ColorAlways
+
+	// ColorNever never colors the output.
+	ColorNever
+)
+
+// Some ANSI escape sequences used by the console encoder.
+const (
+	colorReset   = "\x1b[0m"
+	colorBold    = "\x1b[1m"
+	colorDim     = "\x1b[2m"
+	colorRed     = "\x1b[31m"
+	colorGreen   = "\x1b[32m"
+	colorYellow  = "\x1b[33m"
+	colorBlue    = "\x1b[34m"
+	colorMagenta = "\x1b[35m"
+	colorCyan    = "\x1b[36m"
+)
+
+// ConsoleEncoderConfig is used to configure the console encoder.
+type ConsoleEncoderConfig struct {
+	// Color decides whether to color the output, which is ColorAuto by default.
+	Color ColorMode
+
+	// The layout of the time, which is "15:04:05.000" by default.
+	//
+	// It may be any Go time layout, or TimeUnix, TimeUnixMilli or TimeUnixNano.
+	TimeLayout string
+
+	// The minimum widths of the logger name and the caller, which are
+	// padded with the spaces to align the columns.
+	//
+	// The default are 10 and 24. If they are negative, don't pad them.
+	NameWidth   int
+	CallerWidth int
+
+	// If true, the encoder won't output the caller.
+	NoCaller bool
+
+	// If true, the encoder won't append a newline.
+	NoNewLine bool
+
+	// Valuers is used to override the valuer in the global Valuers,
+	// such as "caller".
+	//
+	// If "time" is given, its value is output instead of the time formatted
+	// by TimeLayout.
+	Valuers map[string]Valuer
+}
+
+func (c *ConsoleEncoderConfig) init() {
+	if c.TimeLayout == "" {
+		c.TimeLayout = "15:04:05.000"
+	}
+	if c.NameWidth == 0 {
+		c.NameWidth = 10
+	}
+	if c.CallerWidth == 0 {
+		c.CallerWidth = 24
+	}
+
+	if c.Valuers == nil {
+		c.Valuers = make(map[string]Valuer, len(Valuers))
+	}
+	for k, v := range Valuers {
+		if _, ok := c.Valuers[k]; !ok {
+			c.Valuers[k] = v
+		}
+	}
+}
+
+type consoleEncoder struct {
+	conf   ConsoleEncoderConfig
+	writer Writer
+	color  bool
+	time   Valuer
+}
+
+// NewConsoleEncoder returns a new human-friendly encoder for the development,
+// which outputs the log as follow:
+//
+//     15:04:05.000 INFO  root       main.go:12               message key1=value1 key2=value2
+//         stack:
+//             line1
+//             line2
+//
+// The level is colored by the severity, and the key-value pairs from the
+// contexts and the arguments are dimmed. The multi-line values, such as
+// the stack trace, are output on the indented continuation lines.
+//
+// Notice: This encoder supports LevelWriter.
+func NewConsoleEncoder(out Writer, conf ...ConsoleEncoderConfig) Encoder {
+	var c ConsoleEncoderConfig
+	if len(conf) > 0 {
+		c = conf[0]
+	}
+	var timeValuer Valuer
+	if c.Valuers != nil {
+		timeValuer = c.Valuers["time"]
+	}
+	c.init()
+
+	e := &consoleEncoder{conf: c, time: timeValuer}
+	e.ResetWriter(out)
+	return e
+}
+
+func (e *consoleEncoder) Writer() Writer {
+	return e.writer
+}
+
+func (e *consoleEncoder) ResetWriter(w Writer) {
+	e.writer = w
+	e.color = isColorable(e.conf.Color, w)
+}
+
+func (e *consoleEncoder) Encode(r Record) error {
+	r.Depth++
+	return e.encode(r)
+}
+
+func (e *consoleEncoder) encode(r Record) (err error) {
+	r.Depth++
+	fields := getFieldList()
+	defer putFieldList(fields)
+	if err = collectFields(r, fields, CollisionOverwrite, ""); err != nil {
+		return
+	}
+
+	w := DefaultBufferPool.Get()
+	defer DefaultBufferPool.Put(w)
+
+	if e.time != nil {
+		v, _ := e.time(r)
+		w.WriteString(json2.ToString(v))
+	} else {
+		json2.Write(w, formatTime(r.now(), e.conf.TimeLayout, time.Local), true)
+	}
+	w.WriteByte(' ')
+
+	e.writeColor(w, levelColor(r.Lvl))
+	lvl := r.Lvl.String()
+	w.WriteString(lvl)
+	e.writeColor(w, colorReset)
+	writePadding(w, 5-len(lvl)+1)
+
+	e.writeColor(w, colorBlue)
+	w.WriteString(r.Name)
+	e.writeColor(w, colorReset)
+	writePadding(w, e.conf.NameWidth-len(r.Name)+1)
+
+	if f, ok := e.conf.Valuers["caller"]; ok && !e.conf.NoCaller {
+		caller, _ := f(r)
+		s := json2.ToString(caller)
+		e.writeColor(w, colorCyan)
+		w.WriteString(s)
+		e.writeColor(w, colorReset)
+		writePadding(w, e.conf.CallerWidth-len(s)+1)
+	}
+
+	msg := r.Msg
+	var msgLines string
+	if index := strings.IndexByte(msg, '\n'); index > -1 {
+		msg, msgLines = msg[:index], msg[index+1:]
+	}
+
+	if r.Lvl >= LvlError {
+		e.writeColor(w, colorBold)
+		w.WriteString(msg)
+		e.writeColor(w, colorReset)
+	} else {
+		w.WriteString(msg)
+	}
+
+	var multiline bool
+	e.writeColor(w, colorDim)
+	e.writeFields(w, "", fields, &multiline, false)
+	e.writeColor(w, colorReset)
+
+	if msgLines != "" {
+		writeIndentedLines(w, "    ", msgLines)
+	}
+	if multiline {
+		e.writeFields(w, "", fields, &multiline, true)
+	}
+
+	if !e.conf.NoNewLine {
+		w.WriteByte('\n')
+	}
+
+	_, err = MayWriteLevel(e.writer, r.Lvl, w.Bytes())
+	return
+}
+
+// writeFields writes the single-line fields as "key=value" if multiline is
+// false, or the multi-line fields on the indented continuation lines.
+func (e *consoleEncoder) writeFields(w *bytes.Buffer, prefix string,
+	l *fieldList, hasMultiline *bool, multiline bool) {
+
+	for _, f := range l.fields {
+		if sub, ok := f.Value.(*fieldList); ok {
+			e.writeFields(w, prefix+f.Key+".", sub, hasMultiline, multiline)
+			continue
+		}
+
+		s, isString := consoleString(f.Value)
+		if isString && strings.IndexByte(s, '\n') > -1 {
+			*hasMultiline = true
+			if multiline {
+				w.WriteString("\n    ")
+				e.writeColor(w, colorDim)
+				w.WriteString(prefix)
+				w.WriteString(f.Key)
+				w.WriteByte(':')
+				e.writeColor(w, colorReset)
+				writeIndentedLines(w, "        ", strings.TrimRight(s, "\n"))
+			}
+			continue
+		} else if multiline {
+			continue
+		}
+
+		w.WriteByte(' ')
+		w.WriteString(prefix)
+		w.WriteString(f.Key)
+		w.WriteByte('=')
+		if isString {
+			writeLogfmtString(w, s)
+		} else {
+			writeLogfmtValue(w, f.Value)
+		}
+	}
+}
+
+func (e *consoleEncoder) writeColor(w *bytes.Buffer, color string) {
+	if e.color {
+		w.WriteString(color)
+	}
+}
+
+// consoleString returns the string representation of v if v is a string
+// or an error, and reports whether it is.
+func consoleString(v interface{}) (string, bool) {
+	switch _v := v.(type) {
+	case string:
+		return _v, true
+	case error:
+		return _v.Error(), true
+	}
+	return "", false
+}
+
+func writeIndentedLines(w *bytes.Buffer, indent, s string) {
+	for _, line := range strings.Split(s, "\n") {
+		w.WriteByte('\n')
+		w.WriteString(indent)
+		w.WriteString(line)
+	}
+}
+
+func writePadding(w *bytes.Buffer, n int) {
+	if n < 1 {
+		n = 1
+	}
+	for ; n > 0; n-- {
+		w.WriteByte(' ')
+	}
+}
+
+func levelColor(lvl Level) string {
+	switch {
+	case lvl >= LvlPanic:
+		return colorBold + colorMagenta
+	case lvl >= LvlError:
+		return colorBold + colorRed
+	case lvl >= LvlWarn:
+		return colorYellow
+	case lvl >= LvlInfo:
+		return colorGreen
+	default:
+		return colorBlue
+	}
+}
+
+// isColorable reports whether to color the output written into w.
+func isColorable(mode ColorMode, w Writer) bool {
+	switch mode {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	switch os.Getenv("FORCE_COLOR") {
+	case "", "0", "false":
+	default:
+		return true
+	}
+	return isTerminal(w)
+}
+
+// isTerminal reports whether w is a terminal.
+func isTerminal(w Writer) bool {
+	if f, ok := w.(*os.File); ok {
+		if fi, err := f.Stat(); err == nil {
+			return fi.Mode()&os.ModeCharDevice != 0
+		}
+	}
+	return false
+}
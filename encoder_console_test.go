@@ -0,0 +1,55 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func ExampleNewConsoleEncoder() {
+	// Only for test to fix the time.
+	conf := ConsoleEncoderConfig{TimeLayout: "TIME", Color: ColorNever}
+
+	log := New(NewConsoleEncoder(os.Stdout, conf)).WithName("example")
+	log.Info("hello world", "key", "value", "http", Group{"status", 200})
+	log.Error("failed", "err", errors.New("error"), "stack", "line1\nline2\n")
+
+	// Output:
+	// TIME INFO  example    encoder_console_test.go:29 hello world key=value http.status=200
+	// TIME ERROR example    encoder_console_test.go:30 failed err=error
+	//     stack:
+	//         line1
+	//         line2
+}
+
+func TestConsoleEncoderColor(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	conf := ConsoleEncoderConfig{TimeLayout: "TIME", Color: ColorAlways, NoCaller: true}
+	New(NewConsoleEncoder(buf, conf)).Warn("msg", "k", "v")
+
+	expected := "TIME \x1b[33mWARN\x1b[0m  \x1b[34mroot\x1b[0m       msg\x1b[2m k=v\x1b[0m\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, but got %q", expected, buf.String())
+	}
+
+	os.Setenv("NO_COLOR", "1")
+	defer os.Unsetenv("NO_COLOR")
+	if isColorable(ColorAuto, os.Stdout) {
+		t.Error("NO_COLOR should disable the color")
+	}
+}
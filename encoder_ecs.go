@@ -0,0 +1,197 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xgfone/go-tools/json2"
+)
+
+// ECSVersion is the default version of Elastic Common Schema.
+const ECSVersion = "1.6.0"
+
+// ECSEncoderConfig is used to configure the ECS encoder.
+type ECSEncoderConfig struct {
+	// The value of the field "ecs.version", which is ECSVersion by default.
+	Version string
+
+	// The namespace that the fields from the contexts and the arguments
+	// are put under, which is "labels" by default.
+	//
+	// Because ECS requires that the labels are the flat key-value pairs
+	// of the strings, the values under "labels" are converted to the strings,
+	// the keys of the nested objects are joined by "_", and the dots
+	// in the keys are replaced with "_".
+	// For the custom namespace, they are output as they are, but it must not
+	// be any field output by the encoder itself, such as "message".
+	Namespace string
+
+	// If true, the encoder won't output the field "log.origin".
+	NoOrigin bool
+
+	// If true, the encoder won't append a newline.
+	NoNewLine bool
+}
+
+// NewECSEncoder returns a new JSON encoder compliant with Elastic Common Schema,
+// which outputs the log as follow:
+//
+//     {"@timestamp":"2019-05-16T17:29:12.000Z","log.level":"error","log.logger":"root","log.origin":{"file.name":"main.go","file.line":12,"function":"main"},"message":"msg","error":{"message":"error","type":"*errors.errorString"},"labels":{"key":"value"},"ecs.version":"1.6.0"}
+//
+// The first value of the type error in the contexts and the arguments,
+// including those in the groups, is output as the field "error" instead of
+// the namespace.
+//
+// It panics if conf.Namespace is the field output by the encoder itself.
+//
+// Notice: This encoder supports LevelWriter.
+func NewECSEncoder(out Writer, conf ...ECSEncoderConfig) Encoder {
+	var c ECSEncoderConfig
+	if len(conf) > 0 {
+		c = conf[0]
+	}
+	if c.Version == "" {
+		c.Version = ECSVersion
+	}
+	if c.Namespace == "" {
+		c.Namespace = "labels"
+	}
+	if _, ok := ecsReservedFields[c.Namespace]; ok {
+		panic(fmt.Errorf("the ECS namespace '%s' conflicts with the field of the encoder", c.Namespace))
+	}
+
+	return EncoderFunc(out, func(out Writer, r Record) (err error) {
+		r.Depth++
+		userFields := getFieldList()
+		if err = collectFields(r, userFields, CollisionOverwrite, ""); err != nil {
+			putFieldList(userFields)
+			return
+		}
+
+		fields := getFieldList()
+		defer putFieldList(fields)
+
+		fields.set(CollisionOverwrite, "@timestamp",
+			r.now().UTC().Format(TimeISO8601Milli))
+		fields.set(CollisionOverwrite, "log.level", strings.ToLower(r.Lvl.String()))
+		if r.Name != "" {
+			fields.set(CollisionOverwrite, "log.logger", r.Name)
+		}
+
+		if !c.NoOrigin {
+			origin := getFieldList()
+			origin.set(CollisionOverwrite, "file.name", r.FileName())
+			origin.set(CollisionOverwrite, "file.line", r.LineAsInt())
+			origin.set(CollisionOverwrite, "function", r.FuncName())
+			fields.set(CollisionOverwrite, "log.origin", origin)
+		}
+
+		fields.set(CollisionOverwrite, "message", r.Msg)
+
+		if e := extractECSError(userFields); e != nil {
+			fields.set(CollisionOverwrite, "error", e)
+		}
+
+		if len(userFields.fields) == 0 {
+			putFieldList(userFields)
+		} else if c.Namespace == "labels" {
+			labels := getFieldList()
+			flattenECSLabels(labels, "", userFields)
+			putFieldList(userFields)
+			fields.set(CollisionOverwrite, c.Namespace, labels)
+		} else {
+			fields.set(CollisionOverwrite, c.Namespace, userFields)
+		}
+
+		fields.set(CollisionOverwrite, "ecs.version", c.Version)
+
+		w := DefaultBufferPool.Get()
+		defer DefaultBufferPool.Put(w)
+
+		if err = writeJSONObject(w, fields); err != nil {
+			return
+		}
+		if !c.NoNewLine {
+			w.WriteByte('\n')
+		}
+
+		_, err = MayWriteLevel(out, r.Lvl, w.Bytes())
+		return
+	})
+}
+
+// ecsReservedFields is the fields output by the ECS encoder itself.
+var ecsReservedFields = map[string]struct{}{
+	"@timestamp":  {},
+	"log.level":   {},
+	"log.logger":  {},
+	"log.origin":  {},
+	"message":     {},
+	"error":       {},
+	"ecs.version": {},
+}
+
+// extractECSError removes the first error from l, including the nested
+// groups in depth-first order, and returns the ECS error object of it.
+func extractECSError(l *fieldList) *fieldList {
+	for i, f := range l.fields {
+		if sub, ok := f.Value.(*fieldList); ok {
+			if obj := extractECSError(sub); obj != nil {
+				return obj
+			}
+			continue
+		}
+
+		e, ok := f.Value.(error)
+		if !ok {
+			continue
+		}
+
+		copy(l.fields[i:], l.fields[i+1:])
+		l.fields[len(l.fields)-1] = field{}
+		l.fields = l.fields[:len(l.fields)-1]
+
+		msg := e.Error()
+		obj := getFieldList()
+		obj.set(CollisionOverwrite, "message", msg)
+		obj.set(CollisionOverwrite, "type", fmt.Sprintf("%T", e))
+		if stack := fmt.Sprintf("%+v", e); stack != msg {
+			obj.set(CollisionOverwrite, "stack_trace", stack)
+		}
+		return obj
+	}
+	return nil
+}
+
+// flattenECSLabels converts the fields in src to the flat string key-value
+// pairs, and adds them into dst.
+func flattenECSLabels(dst *fieldList, prefix string, src *fieldList) {
+	for _, f := range src.fields {
+		key := prefix + strings.Replace(f.Key, ".", "_", -1)
+		switch v := f.Value.(type) {
+		case *fieldList:
+			flattenECSLabels(dst, key+"_", v)
+		case string:
+			dst.set(CollisionOverwrite, key, v)
+		case time.Time:
+			dst.set(CollisionOverwrite, key, v.Format(time.RFC3339Nano))
+		default:
+			dst.set(CollisionOverwrite, key, json2.ToString(v))
+		}
+	}
+}
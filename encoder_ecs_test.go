@@ -0,0 +1,63 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ExampleNewECSEncoder() {
+	clock := ClockFunc(func() time.Time { return time.Date(2019, 5, 16, 17, 29, 12, 0, time.UTC) })
+
+	log1 := LoggerWithClock(New(NewECSEncoder(os.Stdout)), clock).WithName("app")
+	log1.Error("failed", "err", errors.New("error"), "http", Group{"status", 500, "path.raw", "/"})
+
+	log2 := LoggerWithClock(New(NewECSEncoder(os.Stdout, ECSEncoderConfig{Namespace: "app", NoOrigin: true})), clock)
+	log2.Info("ok", "http", Group{"status", 200})
+
+	// Output:
+	// {"@timestamp":"2019-05-16T17:29:12.000Z","log.level":"error","log.logger":"app","log.origin":{"file.name":"encoder_ecs_test.go","file.line":31,"function":"ExampleNewECSEncoder"},"message":"failed","error":{"message":"error","type":"*errors.errorString"},"labels":{"http_status":"500","http_path_raw":"/"},"ecs.version":"1.6.0"}
+	// {"@timestamp":"2019-05-16T17:29:12.000Z","log.level":"info","log.logger":"root","message":"ok","app":{"http":{"status":200}},"ecs.version":"1.6.0"}
+}
+
+func TestECSEncoderNestedError(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := New(NewECSEncoder(buf, ECSEncoderConfig{Namespace: "app", NoOrigin: true}))
+	LoggerWithGroup(log, "http").Error("failed", "status", 500, "err", errors.New("error"))
+
+	const expected = `"message":"failed","error":{"message":"error","type":"*errors.errorString"},"app":{"http":{"status":500}},`
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("expected '%s' in '%s'", expected, buf.String())
+	}
+}
+
+func TestECSEncoderReservedNamespace(t *testing.T) {
+	for _, ns := range []string{"message", "log.level", "@timestamp"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expect a panic", ns)
+				}
+			}()
+			NewECSEncoder(ioutil.Discard, ECSEncoderConfig{Namespace: ns})
+		}()
+	}
+}
@@ -57,3 +57,40 @@ func ExampleNewTextJSONEncoder() {
 	// Output:
 	// time=2019-05-16T17:29:12Z level=INFO caller=encoder_example_test.go:55 encoder=json type=std msg=test encoder
 }
+
+func ExampleCollisionPolicy() {
+	// Only for test to replace the `time` context.
+	valuers := map[string]Valuer{"time": func(r Record) (interface{}, error) { return "2019-05-16T17:29:12Z", nil }}
+
+	policies := []CollisionPolicy{CollisionOverwrite, CollisionKeepFirst, CollisionSuffix, CollisionNest}
+	for _, policy := range policies {
+		conf := JSONEncoderConfig{Valuers: valuers, Collision: policy}
+		log1 := New(NewStdJSONEncoder(os.Stdout, conf)).WithCxt("id", 1, "msg", "ctx")
+		log1.Info("test", "id", 2)
+
+		log2 := New(NewTextJSONEncoder(os.Stdout, conf)).WithCxt("id", 1, "msg", "ctx")
+		log2.Info("test", "id", 2)
+	}
+
+	// Output:
+	// {"id":2,"level":"INFO","msg":"ctx","time":"2019-05-16T17:29:12Z"}
+	// time=2019-05-16T17:29:12Z level=INFO id=2 msg=ctx
+	// {"id":1,"level":"INFO","msg":"test","time":"2019-05-16T17:29:12Z"}
+	// time=2019-05-16T17:29:12Z level=INFO id=1 msg=test
+	// {"id":1,"id_1":2,"level":"INFO","msg":"test","msg_1":"ctx","time":"2019-05-16T17:29:12Z"}
+	// time=2019-05-16T17:29:12Z level=INFO id=1 msg_1=ctx id_1=2 msg=test
+	// {"fields":{"id":2,"msg":"ctx"},"level":"INFO","msg":"test","time":"2019-05-16T17:29:12Z"}
+	// time=2019-05-16T17:29:12Z level=INFO fields.id=2 fields.msg=ctx msg=test
+}
+
+func ExampleNewStreamJSONEncoder() {
+	// Only for test to replace the `time` context.
+	valuers := map[string]Valuer{"time": func(r Record) (interface{}, error) { return "2019-05-16T17:29:12Z", nil }}
+
+	encoder := NewStreamJSONEncoder(os.Stdout, JSONEncoderConfig{Valuers: valuers})
+	log := New(encoder).WithCxt("caller", Caller(), "id", 123)
+	log.Info("test encoder", "encoder", "json", "type", func(r Record) (interface{}, error) { return "stream", nil })
+
+	// Output:
+	// {"time":"2019-05-16T17:29:12Z","level":"INFO","name":"root","msg":"test encoder","caller":"encoder_example_test.go:92","id":123,"encoder":"json","type":"stream"}
+}
@@ -15,8 +15,10 @@
 package logger
 
 import (
+	"bytes"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/xgfone/go-tools/json2"
 	"github.com/xgfone/go-tools/strings2"
@@ -33,6 +35,22 @@ type FmtEncoderConfig struct {
 	//
 	Tmpl string
 
+	// The layout and the location name of the time, which are used to
+	// create the valuers of "time" and "utctime" by TimeValuer to override
+	// the global ones, unless Valuers has contained them.
+	//
+	// TimeLayout may be any Go time layout, or TimeUnix, TimeUnixMilli
+	// or TimeUnixNano to output the time as the integer. It is
+	// time.RFC3339Nano by default.
+	//
+	// TimeLocation is the name of time.Location, such as "UTC", "Local"
+	// or "Asia/Shanghai", which is "Local" by default. It is only used
+	// by "time", and "utctime" always uses "UTC".
+	//
+	// If both are empty, they are ignored.
+	TimeLayout   string
+	TimeLocation string
+
 	// Valuers is used to override the valuers.
 	//
 	// It will use the global Valuers by default, and add the two valuers,
@@ -57,6 +75,10 @@ type FmtEncoderConfig struct {
 // "ctx" formats the contexts and "msg" formats the message by using fmt.Sprintf
 // with the "%" formatter.
 //
+// The contexts are joined by "|", but the key-value pairs in the group,
+// which comes from WithGroup or the value of Group, are formatted
+// as "group.key=value".
+//
 // Notice: This encoder supports LevelWriter.
 func NewFmtEncoder(out Writer, conf ...FmtEncoderConfig) Encoder {
 	var c FmtEncoderConfig
@@ -87,15 +109,21 @@ func NewFmtEncoder(out Writer, conf ...FmtEncoderConfig) Encoder {
 		panic("must not use the default template when customizing left or right delimiters")
 	}
 
-	if c.Valuers == nil {
-		c.Valuers = make(map[string]Valuer, len(Valuers)+4)
+	valuers := make(map[string]Valuer, len(Valuers)+len(c.Valuers)+4)
+	for k, v := range Valuers {
+		valuers[k] = v
+	}
+
+	if c.TimeLayout != "" || c.TimeLocation != "" {
+		loc := loadTimeLocation(c.TimeLocation, time.Local)
+		valuers["time"] = TimeValuer(c.TimeLayout, loc)
+		valuers["utctime"] = TimeValuer(c.TimeLayout, time.UTC)
 	}
 
-	for k, v := range Valuers {
-		if _, ok := c.Valuers[k]; !ok {
-			c.Valuers[k] = v
-		}
+	for k, v := range c.Valuers {
+		valuers[k] = v
 	}
+	c.Valuers = valuers
 
 	if _, ok := c.Valuers["msg"]; !ok {
 		c.Valuers["msg"] = func(r Record) (v interface{}, err error) {
@@ -119,16 +147,8 @@ func NewFmtEncoder(out Writer, conf ...FmtEncoderConfig) Encoder {
 			defer DefaultBufferPool.Put(buf)
 
 			r.Depth++
-			for i, ctx := range r.Ctxs {
-				if i > 0 {
-					buf.WriteByte('|')
-				}
-				if ctx, err = MayBeValuer(r, ctx); err != nil {
-					return
-				}
-				if err = json2.Write(buf, ctx, true); err != nil {
-					return
-				}
+			if err = writeFmtContexts(buf, r, r.Ctxs); err != nil {
+				return
 			}
 			return buf.String(), nil
 		}
@@ -154,3 +174,89 @@ func NewFmtEncoder(out Writer, conf ...FmtEncoderConfig) Encoder {
 		return
 	})
 }
+
+// writeFmtContexts writes the contexts joined by "|" into w.
+func writeFmtContexts(w *bytes.Buffer, r Record, ctxs []interface{}) (err error) {
+	r.Depth++
+	var v interface{}
+	for i, _len := 0, len(ctxs); i < _len; i++ {
+		// All the subsequent contexts are in the group opened by WithGroup.
+		if _, ok := ctxs[i].(groupKey); ok && i+1 < _len {
+			if i > 0 && i+2 < _len {
+				w.WriteByte('|')
+			}
+			prefix := json2.ToString(ctxs[i+1])
+			return writeFmtGroup(w, r, prefix, ctxs[i+2:])
+		}
+
+		if i > 0 {
+			w.WriteByte('|')
+		}
+
+		if v, err = MayBeValuer(r, ctxs[i]); err != nil {
+			return
+		}
+
+		if i+1 < _len {
+			if g, ok := ctxs[i+1].(Group); ok {
+				if err = writeFmtGroup(w, r, json2.ToString(v), g); err != nil {
+					return
+				}
+				i++
+				continue
+			}
+		}
+
+		if err = json2.Write(w, v, true); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// writeFmtGroup writes the key-value pairs in the group as "prefix.key=value"
+// joined by "|" into w.
+func writeFmtGroup(w *bytes.Buffer, r Record, prefix string,
+	kvs []interface{}) (err error) {
+
+	if len(kvs)%2 != 0 {
+		return ErrKeyValueNum
+	}
+
+	r.Depth++
+	var k, v interface{}
+	for i, _len := 0, len(kvs); i < _len; i += 2 {
+		if _, ok := kvs[i].(groupKey); ok {
+			if i > 0 && i+2 < _len {
+				w.WriteByte('|')
+			}
+			prefix = prefix + "." + json2.ToString(kvs[i+1])
+			return writeFmtGroup(w, r, prefix, kvs[i+2:])
+		}
+
+		if k, err = MayBeValuer(r, kvs[i]); err != nil {
+			return
+		}
+		if v, err = MayBeValuer(r, kvs[i+1]); err != nil {
+			return
+		}
+
+		if i > 0 {
+			w.WriteByte('|')
+		}
+		key := prefix + "." + json2.ToString(k)
+		if g, ok := v.(Group); ok {
+			if err = writeFmtGroup(w, r, key, g); err != nil {
+				return
+			}
+			continue
+		}
+
+		w.WriteString(key)
+		w.WriteByte('=')
+		if err = json2.Write(w, v, true); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -16,6 +16,7 @@ package logger
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/xgfone/go-tools/json2"
 )
@@ -28,6 +29,22 @@ type JSONEncoderConfig struct {
 	// It is "time" by default. You can set it to "utctime" to output UTC time.
 	TimeKey string
 
+	// The layout and the location name of the time, which is used to create
+	// the valuer of TimeKey by TimeValuer to override the global one,
+	// unless Valuers has contained TimeKey.
+	//
+	// TimeLayout may be any Go time layout, or TimeUnix, TimeUnixMilli
+	// or TimeUnixNano to output the time as the integer. It is
+	// time.RFC3339Nano by default.
+	//
+	// TimeLocation is the name of time.Location, such as "UTC", "Local"
+	// or "Asia/Shanghai". It is "Local" by default, but "UTC" if TimeKey
+	// is "utctime".
+	//
+	// If both are empty, they are ignored.
+	TimeLayout   string
+	TimeLocation string
+
 	// The key name of the level, which the encoder will extract its value
 	// from the global Valuers and output them as the key-value.
 	//
@@ -35,6 +52,13 @@ type JSONEncoderConfig struct {
 	// the short name of level.
 	LevelKey string
 
+	// The key name of the logger name, which the encoder will extract its
+	// value from the global Valuers and output them as the key-value.
+	//
+	// It is empty by default, that's, the logger name won't be output.
+	// You can set it to "name" to output it.
+	NameKey string
+
 	// The name of the message, which is "msg" by default.
 	MsgKey string
 
@@ -44,6 +68,20 @@ type JSONEncoderConfig struct {
 	// Valuers can be used to override the valuer in the global Valuers.
 	Valuers map[string]Valuer
 
+	// Collision is the policy to handle the key collision between the fields,
+	// including the reserved keys, such as TimeKey, LevelKey and MsgKey.
+	//
+	// The default is CollisionOverwrite, that's, the latter overwrites
+	// the former.
+	Collision CollisionPolicy
+
+	// The key name of the nested object, which all the fields from the
+	// contexts and the arguments will be moved into when Collision is
+	// CollisionNest.
+	//
+	// The default is "fields".
+	FieldsKey string
+
 	// The separators between key and value or key-value pairs.
 	//
 	// Notice: it's only used by the NewTextJSONEncoder encoder.
@@ -61,6 +99,9 @@ func (c *JSONEncoderConfig) init() {
 	if c.MsgKey == "" {
 		c.MsgKey = "msg"
 	}
+	if c.FieldsKey == "" {
+		c.FieldsKey = "fields"
+	}
 
 	if c.TextKVSep == "" {
 		c.TextKVSep = "="
@@ -69,14 +110,24 @@ func (c *JSONEncoderConfig) init() {
 		c.TextKVPairSep = " "
 	}
 
-	if c.Valuers == nil {
-		c.Valuers = make(map[string]Valuer, len(Valuers)*2)
-	}
+	valuers := make(map[string]Valuer, len(Valuers)+len(c.Valuers)+1)
 	for k, v := range Valuers {
-		if _, ok := c.Valuers[k]; !ok {
-			c.Valuers[k] = v
+		valuers[k] = v
+	}
+
+	if c.TimeLayout != "" || c.TimeLocation != "" {
+		loc := time.Local
+		if c.TimeKey == "utctime" {
+			loc = time.UTC
 		}
+		loc = loadTimeLocation(c.TimeLocation, loc)
+		valuers[c.TimeKey] = TimeValuer(c.TimeLayout, loc)
 	}
+
+	for k, v := range c.Valuers {
+		valuers[k] = v
+	}
+	c.Valuers = valuers
 }
 
 // NewJSONEncoder encodes the log as the JSON and outputs it to w.
@@ -95,46 +146,31 @@ func NewJSONEncoder(encodeJSON func(w Writer, newline bool, v interface{}) error
 
 	return EncoderFunc(w, func(out Writer, r Record) (err error) {
 		r.Depth++
-		_len := 3
-		argslen := len(r.Args)
-		ctxslen := len(r.Ctxs)
-		if argslen%2 != 0 || ctxslen%2 != 0 {
-			return ErrKeyValueNum
-		}
-		_len += argslen/2 + ctxslen/2
-		maps := make(map[string]interface{}, _len)
-		maps[c.MsgKey] = r.Msg
+		fields := getFieldList()
+		fields.set(c.Collision, c.MsgKey, r.Msg)
 
 		if f, ok := c.Valuers[c.LevelKey]; ok {
 			lvl, _ := f(r)
-			maps[c.LevelKey] = lvl
+			fields.set(c.Collision, c.LevelKey, lvl)
 		}
 
 		if f, ok := c.Valuers[c.TimeKey]; ok {
 			now, _ := f(r)
-			maps[c.TimeKey] = now
+			fields.set(c.Collision, c.TimeKey, now)
 		}
 
-		var v1, v2 interface{}
-		for i := 0; i < ctxslen; i += 2 {
-			if v1, err = MayBeValuer(r, r.Ctxs[i]); err != nil {
-				return err
-			}
-			if v2, err = MayBeValuer(r, r.Ctxs[i+1]); err != nil {
-				return err
-			}
-			maps[json2.ToString(v1)] = v2
+		if f, ok := c.Valuers[c.NameKey]; ok {
+			name, _ := f(r)
+			fields.set(c.Collision, c.NameKey, name)
 		}
-		for i := 0; i < argslen; i += 2 {
-			if v1, err = MayBeValuer(r, r.Args[i]); err != nil {
-				return err
-			}
-			if v2, err = MayBeValuer(r, r.Args[i+1]); err != nil {
-				return err
-			}
-			maps[json2.ToString(v1)] = v2
+
+		if err = collectFields(r, fields, c.Collision, c.FieldsKey); err != nil {
+			putFieldList(fields)
+			return err
 		}
 
+		maps := fields.toMap()
+		putFieldList(fields)
 		return encodeJSON(w, !c.NoNewLine, maps)
 	})
 }
@@ -0,0 +1,252 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// NewStreamJSONEncoder returns a new JSON encoder, which writes the log record
+// into the buffer straightly and keeps the order of the keys, that's,
+// time, level, name and msg firstly, then the contexts in the order of WithCxt,
+// and the arguments in the order of the call at last, for example,
+//
+//     {"time":"2019-05-16T17:29:12Z","level":"INFO","name":"root","msg":"test","key":"value"}
+//
+// It uses "name" as NameKey by default, and handles the key collision
+// by conf.Collision like NewJSONEncoder.
+//
+// Notice: This encoder supports LevelWriter.
+func NewStreamJSONEncoder(out Writer, conf ...JSONEncoderConfig) Encoder {
+	var c JSONEncoderConfig
+	if len(conf) > 0 {
+		c = conf[0]
+	}
+	if c.NameKey == "" {
+		c.NameKey = "name"
+	}
+	c.init()
+
+	return EncoderFunc(out, func(out Writer, r Record) (err error) {
+		r.Depth++
+		fields := getFieldList()
+		defer putFieldList(fields)
+
+		setReservedFields(r, fields, &c)
+		if err = collectFields(r, fields, c.Collision, c.FieldsKey); err != nil {
+			return
+		}
+
+		w := DefaultBufferPool.Get()
+		defer DefaultBufferPool.Put(w)
+
+		if err = writeJSONObject(w, fields); err != nil {
+			return
+		}
+		if !c.NoNewLine {
+			w.WriteByte('\n')
+		}
+
+		_, err = MayWriteLevel(out, r.Lvl, w.Bytes())
+		return
+	})
+}
+
+// writeJSONObject writes the fields into w as a JSON object in order.
+func writeJSONObject(w *bytes.Buffer, l *fieldList) (err error) {
+	w.WriteByte('{')
+	for i, f := range l.fields {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		writeJSONString(w, f.Key)
+		w.WriteByte(':')
+		if err = writeJSONValue(w, f.Value); err != nil {
+			return
+		}
+	}
+	w.WriteByte('}')
+	return
+}
+
+// writeJSONValue writes the value into w as JSON.
+//
+// The error is written as the string by its Error method, and the types
+// implementing fmt.Stringer are written as the string by its String method,
+// unless they have implemented json.Marshaler.
+func writeJSONValue(w *bytes.Buffer, v interface{}) (err error) {
+	var scratch [64]byte
+	switch _v := v.(type) {
+	case nil:
+		w.WriteString("null")
+	case string:
+		writeJSONString(w, _v)
+	case []byte:
+		writeJSONString(w, string(_v))
+	case bool:
+		w.Write(strconv.AppendBool(scratch[:0], _v))
+	case int:
+		w.Write(strconv.AppendInt(scratch[:0], int64(_v), 10))
+	case int8:
+		w.Write(strconv.AppendInt(scratch[:0], int64(_v), 10))
+	case int16:
+		w.Write(strconv.AppendInt(scratch[:0], int64(_v), 10))
+	case int32:
+		w.Write(strconv.AppendInt(scratch[:0], int64(_v), 10))
+	case int64:
+		w.Write(strconv.AppendInt(scratch[:0], _v, 10))
+	case uint:
+		w.Write(strconv.AppendUint(scratch[:0], uint64(_v), 10))
+	case uint8:
+		w.Write(strconv.AppendUint(scratch[:0], uint64(_v), 10))
+	case uint16:
+		w.Write(strconv.AppendUint(scratch[:0], uint64(_v), 10))
+	case uint32:
+		w.Write(strconv.AppendUint(scratch[:0], uint64(_v), 10))
+	case uint64:
+		w.Write(strconv.AppendUint(scratch[:0], _v, 10))
+	case float32:
+		writeJSONFloat(w, scratch[:0], float64(_v), 32)
+	case float64:
+		writeJSONFloat(w, scratch[:0], _v, 64)
+	case time.Time:
+		w.WriteByte('"')
+		w.Write(_v.AppendFormat(scratch[:0], time.RFC3339Nano))
+		w.WriteByte('"')
+	case time.Duration:
+		writeJSONString(w, _v.String())
+	case *fieldList:
+		return writeJSONObject(w, _v)
+	case json.Marshaler:
+		if isNilPointer(v) {
+			w.WriteString("null")
+			return
+		}
+
+		var bs []byte
+		if bs, err = _v.MarshalJSON(); err != nil {
+			return
+		}
+		// Compact it like encoding/json, so the output is always one line.
+		return json.Compact(w, bs)
+	case error:
+		if isNilPointer(v) {
+			w.WriteString("null")
+		} else {
+			writeJSONString(w, _v.Error())
+		}
+	case fmt.Stringer:
+		if isNilPointer(v) {
+			w.WriteString("null")
+		} else {
+			writeJSONString(w, _v.String())
+		}
+	default:
+		var bs []byte
+		if bs, err = json.Marshal(v); err != nil {
+			return
+		}
+		w.Write(bs)
+	}
+	return
+}
+
+// isNilPointer reports whether v is a typed nil pointer, whose methods,
+// such as MarshalJSON, Error and String, may panic when called.
+func isNilPointer(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
+
+func writeJSONFloat(w *bytes.Buffer, buf []byte, f float64, bits int) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		w.WriteByte('"')
+		w.Write(strconv.AppendFloat(buf, f, 'g', -1, bits))
+		w.WriteByte('"')
+		return
+	}
+
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	w.Write(strconv.AppendFloat(buf, f, format, -1, bits))
+}
+
+const hexDigits = "0123456789abcdef"
+
+// writeJSONString writes s into w as the JSON string with the double quotes,
+// and the invalid UTF-8 bytes are replaced with U+FFFD.
+func writeJSONString(w *bytes.Buffer, s string) {
+	w.WriteByte('"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' {
+				i++
+				continue
+			}
+
+			w.WriteString(s[start:i])
+			switch b {
+			case '"', '\\':
+				w.WriteByte('\\')
+				w.WriteByte(b)
+			case '\n':
+				w.WriteString(`\n`)
+			case '\r':
+				w.WriteString(`\r`)
+			case '\t':
+				w.WriteString(`\t`)
+			default:
+				w.WriteString(`\u00`)
+				w.WriteByte(hexDigits[b>>4])
+				w.WriteByte(hexDigits[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		c, size := utf8.DecodeRuneInString(s[i:])
+		if c == utf8.RuneError && size == 1 {
+			w.WriteString(s[start:i])
+			w.WriteString(`\ufffd`)
+			i += size
+			start = i
+			continue
+		}
+
+		// U+2028 and U+2029 are valid in JSON, but not in JavaScript.
+		if c == '\u2028' || c == '\u2029' {
+			w.WriteString(s[start:i])
+			w.WriteString(`\u202`)
+			w.WriteByte(hexDigits[c&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	w.WriteString(s[start:])
+	w.WriteByte('"')
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestWriteJSONString(t *testing.T) {
+	ss := []string{"", "abc", `a"b\c`, "line1\nline2\r\t", "\x00\x1f\x7f", "中文", "\u2028\u2029", "bad\xffutf8"}
+	buf := bytes.NewBuffer(nil)
+	for _, s := range ss {
+		buf.Reset()
+		writeJSONString(buf, s)
+
+		var v string
+		if err := json.Unmarshal(buf.Bytes(), &v); err != nil {
+			t.Errorf("%q: %s", buf.String(), err)
+		} else if expected := bytes.ToValidUTF8([]byte(s), []byte("\ufffd")); v != string(expected) {
+			t.Errorf("expected %q, but got %q", expected, v)
+		}
+	}
+}
+
+func TestWriteJSONValue(t *testing.T) {
+	values := []struct {
+		value  interface{}
+		result string
+	}{
+		{nil, `null`},
+		{true, `true`},
+		{-123, `-123`},
+		{uint8(255), `255`},
+		{1.5, `1.5`},
+		{1e21, `1e+21`},
+		{errors.New("error"), `"error"`},
+		{LvlInfo, `"INFO"`},
+		{[]int{1, 2}, `[1,2]`},
+		{(*ptrMarshaler)(nil), `null`},
+		{(*ptrError)(nil), `null`},
+		{(*ptrStringer)(nil), `null`},
+		{&ptrMarshaler{"a"}, `"a"`},
+		{&ptrError{"b"}, `"b"`},
+		{&ptrStringer{"c"}, `"c"`},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	for _, v := range values {
+		buf.Reset()
+		if err := writeJSONValue(buf, v.value); err != nil {
+			t.Error(err)
+		} else if buf.String() != v.result {
+			t.Errorf("expected %s, but got %s", v.result, buf.String())
+		}
+	}
+}
+
+type ptrMarshaler struct{ s string }
+type ptrError struct{ s string }
+type ptrStringer struct{ s string }
+
+func (p *ptrMarshaler) MarshalJSON() ([]byte, error) { return json.Marshal(p.s) }
+func (p *ptrError) Error() string                    { return p.s }
+func (p *ptrStringer) String() string                { return p.s }
+
+type rawJSON string
+
+func (r rawJSON) MarshalJSON() ([]byte, error) { return []byte(r), nil }
+
+func TestWriteJSONValueMarshaler(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	if err := writeJSONValue(buf, rawJSON("{\n  \"a\": [1, 2]\n}")); err != nil {
+		t.Error(err)
+	} else if buf.String() != `{"a":[1,2]}` {
+		t.Errorf("unexpected output %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := writeJSONValue(buf, rawJSON("{invalid")); err == nil {
+		t.Errorf("expect an error, but got %s", buf.String())
+	}
+}
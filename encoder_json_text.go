@@ -14,11 +14,19 @@
 
 package logger
 
-import "github.com/xgfone/go-tools/json2"
+import (
+	"bytes"
+
+	"github.com/xgfone/go-tools/json2"
+)
 
 // NewTextJSONEncoder returns a text encoder based on the key-value pair,
 // which will output the result into out.
 //
+// It handles the key collision by conf.Collision like NewJSONEncoder,
+// and the key of the nested object is joined by the dot, such as
+// "fields.key=value".
+//
 // Notice: This encoder supports LevelWriter.
 func NewTextJSONEncoder(out Writer, conf ...JSONEncoderConfig) Encoder {
 	var c JSONEncoderConfig
@@ -27,97 +35,75 @@ func NewTextJSONEncoder(out Writer, conf ...JSONEncoderConfig) Encoder {
 	}
 	c.init()
 
-	return EncoderFunc(out, func(out Writer, r Record) error {
+	return EncoderFunc(out, func(out Writer, r Record) (err error) {
 		r.Depth++
-		arglen := len(r.Args)
-		ctxlen := len(r.Ctxs)
-		if arglen%2 != 0 || ctxlen%2 != 0 {
-			return ErrKeyValueNum
+		fields := getFieldList()
+		defer putFieldList(fields)
+
+		setReservedFields(r, fields, &c)
+		if err = collectFields(r, fields, c.Collision, c.FieldsKey); err != nil {
+			return
 		}
 
-		var err error
-		var v interface{}
-		var sep bool
 		w := DefaultBufferPool.Get()
 		defer DefaultBufferPool.Put(w)
 
-		if f, ok := c.Valuers[c.TimeKey]; ok {
-			now, _ := f(r)
-			w.WriteString(c.TimeKey)
-			w.WriteString(c.TextKVSep)
-			json2.Write(w, now, true)
-			sep = true
-		}
-
-		if f, ok := c.Valuers[c.LevelKey]; ok {
-			if sep {
-				w.WriteString(c.TextKVPairSep)
-			}
-
-			lvl, _ := f(r)
-			w.WriteString(c.LevelKey)
-			w.WriteString(c.TextKVSep)
-			json2.Write(w, lvl, true)
-			sep = true
-		}
-
-		for i := 0; i < ctxlen; i += 2 {
-			if sep {
-				w.WriteString(c.TextKVPairSep)
-			}
-
-			if v, err = MayBeValuer(r, r.Ctxs[i]); err != nil {
-				return err
-			}
-			if err = json2.Write(w, v, true); err != nil {
-				return err
-			}
-			w.WriteString(c.TextKVSep)
-			if v, err = MayBeValuer(r, r.Ctxs[i+1]); err != nil {
-				return err
-			}
-			if err = json2.Write(w, v, true); err != nil {
-				return err
-			}
-			sep = true
-		}
-
-		for i := 0; i < arglen; i += 2 {
-			if sep {
-				w.WriteString(c.TextKVPairSep)
-			}
-
-			if v, err = MayBeValuer(r, r.Args[i]); err != nil {
-				return err
-			}
-			if err = json2.Write(w, v, true); err != nil {
-				return err
-			}
-
-			w.WriteString(c.TextKVSep)
-
-			if v, err = MayBeValuer(r, r.Args[i+1]); err != nil {
-				return err
+		// The message is always the last.
+		var msg field
+		var sep bool
+		for _, f := range fields.fields {
+			if f.Key == c.MsgKey {
+				msg = f
+				continue
 			}
-			if err = json2.Write(w, v, true); err != nil {
-				return err
+			if sep, err = writeTextField(w, &c, sep, "", f); err != nil {
+				return
 			}
-			sep = true
 		}
 
 		if sep {
 			w.WriteString(c.TextKVPairSep)
 		}
-
 		w.WriteString(c.MsgKey)
 		w.WriteString(c.TextKVSep)
-		w.WriteString(r.Msg)
+		if s, ok := msg.Value.(string); ok {
+			w.WriteString(s)
+		} else if err = json2.Write(w, msg.Value, true); err != nil {
+			return
+		}
 
 		if !c.NoNewLine {
 			w.WriteByte('\n')
 		}
 
 		_, err = MayWriteLevel(out, r.Lvl, w.Bytes())
-		return err
+		return
 	})
 }
+
+// writeTextField writes the field as "key=value", and the fields of the nested
+// object are written as "prefix.key=value".
+func writeTextField(w *bytes.Buffer, c *JSONEncoderConfig, sep bool,
+	prefix string, f field) (bool, error) {
+
+	if prefix != "" {
+		f.Key = prefix + "." + f.Key
+	}
+
+	if sub, ok := f.Value.(*fieldList); ok {
+		var err error
+		for _, _f := range sub.fields {
+			if sep, err = writeTextField(w, c, sep, f.Key, _f); err != nil {
+				return sep, err
+			}
+		}
+		return sep, nil
+	}
+
+	if sep {
+		w.WriteString(c.TextKVPairSep)
+	}
+	w.WriteString(f.Key)
+	w.WriteString(c.TextKVSep)
+	return true, json2.Write(w, f.Value, true)
+}
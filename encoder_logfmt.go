@@ -0,0 +1,181 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// NewLogfmtEncoder returns a new encoder based on logfmt, which will output
+// the result into out, for example,
+//
+//     time=2019-05-16T17:29:12Z level=INFO msg="hello world" key=value
+//
+// The key is bare, and any character which is not allowed by logfmt,
+// that's, the space, the control characters, '=' and '"', is replaced by '_'.
+// The value is quoted only if it is empty or it contains the space, '=', '"',
+// '\' or the control characters, and they are escaped as the JSON string.
+//
+// It uses the same fields as NewStreamJSONEncoder in the same order, including
+// "name" as NameKey by default, and the fields of the nested object are output
+// as "group.key=value". But TextKVSep and TextKVPairSep in conf are ignored.
+//
+// Notice: This encoder supports LevelWriter.
+func NewLogfmtEncoder(out Writer, conf ...JSONEncoderConfig) Encoder {
+	var c JSONEncoderConfig
+	if len(conf) > 0 {
+		c = conf[0]
+	}
+	if c.NameKey == "" {
+		c.NameKey = "name"
+	}
+	c.init()
+
+	return EncoderFunc(out, func(out Writer, r Record) (err error) {
+		r.Depth++
+		fields := getFieldList()
+		defer putFieldList(fields)
+
+		setReservedFields(r, fields, &c)
+		if err = collectFields(r, fields, c.Collision, c.FieldsKey); err != nil {
+			return
+		}
+
+		w := DefaultBufferPool.Get()
+		defer DefaultBufferPool.Put(w)
+
+		writeLogfmtFields(w, "", fields)
+		if !c.NoNewLine {
+			w.WriteByte('\n')
+		}
+
+		_, err = MayWriteLevel(out, r.Lvl, w.Bytes())
+		return
+	})
+}
+
+func writeLogfmtFields(w *bytes.Buffer, prefix string, l *fieldList) {
+	for _, f := range l.fields {
+		if sub, ok := f.Value.(*fieldList); ok {
+			writeLogfmtFields(w, prefix+f.Key+".", sub)
+			continue
+		}
+
+		if w.Len() > 0 {
+			w.WriteByte(' ')
+		}
+		writeLogfmtKey(w, prefix+f.Key)
+		w.WriteByte('=')
+		writeLogfmtValue(w, f.Value)
+	}
+}
+
+// writeLogfmtKey writes the key, the invalid characters of which are replaced
+// with '_'. If the key is empty, it is replaced with "_".
+func writeLogfmtKey(w *bytes.Buffer, key string) {
+	if key == "" {
+		w.WriteByte('_')
+		return
+	}
+
+	for i := 0; i < len(key); {
+		c, size := utf8.DecodeRuneInString(key[i:])
+		if c <= ' ' || c == '=' || c == '"' || c == utf8.RuneError ||
+			c == 0x7f || (c >= 0x80 && c < 0xa0) {
+			w.WriteByte('_')
+		} else {
+			w.WriteString(key[i : i+size])
+		}
+		i += size
+	}
+}
+
+func writeLogfmtValue(w *bytes.Buffer, v interface{}) {
+	var scratch [64]byte
+	switch _v := v.(type) {
+	case nil:
+		w.WriteString("null")
+	case string:
+		writeLogfmtString(w, _v)
+	case []byte:
+		writeLogfmtString(w, string(_v))
+	case bool:
+		w.Write(strconv.AppendBool(scratch[:0], _v))
+	case int:
+		w.Write(strconv.AppendInt(scratch[:0], int64(_v), 10))
+	case int8:
+		w.Write(strconv.AppendInt(scratch[:0], int64(_v), 10))
+	case int16:
+		w.Write(strconv.AppendInt(scratch[:0], int64(_v), 10))
+	case int32:
+		w.Write(strconv.AppendInt(scratch[:0], int64(_v), 10))
+	case int64:
+		w.Write(strconv.AppendInt(scratch[:0], _v, 10))
+	case uint:
+		w.Write(strconv.AppendUint(scratch[:0], uint64(_v), 10))
+	case uint8:
+		w.Write(strconv.AppendUint(scratch[:0], uint64(_v), 10))
+	case uint16:
+		w.Write(strconv.AppendUint(scratch[:0], uint64(_v), 10))
+	case uint32:
+		w.Write(strconv.AppendUint(scratch[:0], uint64(_v), 10))
+	case uint64:
+		w.Write(strconv.AppendUint(scratch[:0], _v, 10))
+	case float32:
+		w.Write(strconv.AppendFloat(scratch[:0], float64(_v), 'g', -1, 32))
+	case float64:
+		w.Write(strconv.AppendFloat(scratch[:0], _v, 'g', -1, 64))
+	case time.Time:
+		w.Write(_v.AppendFormat(scratch[:0], time.RFC3339Nano))
+	case time.Duration:
+		w.WriteString(_v.String())
+	case error:
+		writeLogfmtString(w, _v.Error())
+	case fmt.Stringer:
+		writeLogfmtString(w, _v.String())
+	default:
+		writeLogfmtString(w, fmt.Sprint(v))
+	}
+}
+
+// writeLogfmtString writes the string value, which is quoted only if needed.
+func writeLogfmtString(w *bytes.Buffer, s string) {
+	if logfmtNeedsQuote(s) {
+		writeJSONString(w, s)
+	} else {
+		w.WriteString(s)
+	}
+}
+
+func logfmtNeedsQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+
+	for i := 0; i < len(s); {
+		c, size := utf8.DecodeRuneInString(s[i:])
+		if c <= ' ' || c == '=' || c == '"' || c == '\\' || c == 0x7f ||
+			c == utf8.RuneError || c == '\u2028' || c == '\u2029' ||
+			(c >= 0x80 && c < 0xa0) {
+			return true
+		}
+		i += size
+	}
+	return false
+}
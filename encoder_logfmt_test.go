@@ -0,0 +1,46 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func ExampleNewLogfmtEncoder() {
+	// Only for test to replace the `time` context.
+	valuers := map[string]Valuer{"time": func(r Record) (interface{}, error) { return "2019-05-16T17:29:12Z", nil }}
+
+	encoder := NewLogfmtEncoder(os.Stdout, JSONEncoderConfig{Valuers: valuers})
+	log := LoggerWithGroup(New(encoder).WithCxt("caller", Caller()), "http")
+	log.Info("test\n\"logfmt\"", "method", "GET", "path", `C:\a b`, "err", errors.New("error"))
+
+	// Output:
+	// time=2019-05-16T17:29:12Z level=INFO name=root msg="test\n\"logfmt\"" caller=encoder_logfmt_test.go:30 http.method=GET http.path="C:\\a b" http.err=error
+}
+
+func TestLogfmtEncoder(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	conf := JSONEncoderConfig{TimeKey: "-", LevelKey: "-", NameKey: "-"}
+	log := New(NewLogfmtEncoder(buf, conf))
+	log.Info("", "a b", 1, "k=v", 1.5, `"q"`, "", "", nil, "ok", true)
+
+	expected := `msg="" a_b=1 k_v=1.5 _q_="" _=null ok=true` + "\n"
+	if buf.String() != expected {
+		t.Errorf("expected '%s', but got '%s'", expected, buf.String())
+	}
+}
@@ -0,0 +1,364 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// The extension types of MessagePack used by the binary encoder.
+const (
+	MsgpackExtTimestamp = -1 // The timestamp defined by MessagePack.
+	MsgpackExtDuration  = 1  // time.Duration as the big-endian int64 nanoseconds.
+	MsgpackExtJSON      = 2  // The raw JSON of the value of the unknown type.
+)
+
+// MsgpackEncoderConfig is used to configure the MessagePack encoder.
+type MsgpackEncoderConfig struct {
+	// If true, the encoder won't output the caller.
+	NoCaller bool
+}
+
+// NewMsgpackEncoder returns a new binary encoder based on MessagePack,
+// which is much cheaper than the JSON encoders.
+//
+// Every record is written by a single call of out.Write as a frame, which is
+// the 4-byte big-endian length of the payload followed by the payload.
+// The payload is a MessagePack map as follow:
+//
+//     {
+//         "t": <timestamp>,                                // Time
+//         "l": <int>,                                      // Level
+//         "n": <string>,                                   // Name
+//         "m": <string>,                                   // Msg
+//         "c": {"file": <string>, "line": <int>, "func": <string>}, // Caller
+//         "f": {"key": <value>, "group": {"key": <value>}}, // Ctxs and Args
+//     }
+//
+// "c" is omitted if conf.NoCaller is true, and "f" is omitted if there is
+// no field. The fields keep the order, and the group is a nested map.
+//
+// The values of nil, bool, the integers, float32, float64, string, []byte,
+// []interface{} and map[string]interface{} are encoded as the native types
+// of MessagePack, the signed integers are always encoded as int formats and
+// the unsigned as uint formats. time.Time is encoded as the timestamp
+// extension, and time.Duration as the extension MsgpackExtDuration.
+// error and fmt.Stringer are encoded as string, and the values of other
+// types are encoded as the extension MsgpackExtJSON by json.Marshal.
+//
+// The sub-package msgpack provides the decoder to read the records back.
+//
+// Notice: This encoder supports LevelWriter.
+func NewMsgpackEncoder(out Writer, conf ...MsgpackEncoderConfig) Encoder {
+	var c MsgpackEncoderConfig
+	if len(conf) > 0 {
+		c = conf[0]
+	}
+
+	return EncoderFunc(out, func(out Writer, r Record) (err error) {
+		r.Depth++
+		fields := getFieldList()
+		defer putFieldList(fields)
+		if err = collectFields(r, fields, CollisionOverwrite, ""); err != nil {
+			return
+		}
+
+		w := DefaultBufferPool.Get()
+		defer DefaultBufferPool.Put(w)
+
+		w.Write([]byte{0, 0, 0, 0}) // Reserve the length of the payload.
+
+		size := 4
+		if !c.NoCaller {
+			size++
+		}
+		if len(fields.fields) > 0 {
+			size++
+		}
+		writeMsgpackMapHeader(w, size)
+
+		writeMsgpackString(w, "t")
+		writeMsgpackTime(w, r.now())
+		writeMsgpackString(w, "l")
+		writeMsgpackInt(w, int64(r.Lvl))
+		writeMsgpackString(w, "n")
+		writeMsgpackString(w, r.Name)
+		writeMsgpackString(w, "m")
+		writeMsgpackString(w, r.Msg)
+
+		if !c.NoCaller {
+			writeMsgpackString(w, "c")
+			writeMsgpackMapHeader(w, 3)
+			writeMsgpackString(w, "file")
+			writeMsgpackString(w, r.LongFileName())
+			writeMsgpackString(w, "line")
+			writeMsgpackInt(w, int64(r.LineAsInt()))
+			writeMsgpackString(w, "func")
+			writeMsgpackString(w, r.QualifiedFuncName())
+		}
+
+		if len(fields.fields) > 0 {
+			writeMsgpackString(w, "f")
+			if err = writeMsgpackFields(w, fields); err != nil {
+				return
+			}
+		}
+
+		bs := w.Bytes()
+		binary.BigEndian.PutUint32(bs[:4], uint32(len(bs)-4))
+		_, err = MayWriteLevel(out, r.Lvl, bs)
+		return
+	})
+}
+
+func writeMsgpackFields(w *bytes.Buffer, l *fieldList) (err error) {
+	writeMsgpackMapHeader(w, len(l.fields))
+	for _, f := range l.fields {
+		writeMsgpackString(w, f.Key)
+		if err = writeMsgpackValue(w, f.Value); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func writeMsgpackValue(w *bytes.Buffer, v interface{}) (err error) {
+	switch _v := v.(type) {
+	case nil:
+		w.WriteByte(0xc0)
+	case bool:
+		if _v {
+			w.WriteByte(0xc3)
+		} else {
+			w.WriteByte(0xc2)
+		}
+	case int:
+		writeMsgpackInt(w, int64(_v))
+	case int8:
+		writeMsgpackInt(w, int64(_v))
+	case int16:
+		writeMsgpackInt(w, int64(_v))
+	case int32:
+		writeMsgpackInt(w, int64(_v))
+	case int64:
+		writeMsgpackInt(w, _v)
+	case uint:
+		writeMsgpackUint(w, uint64(_v))
+	case uint8:
+		writeMsgpackUint(w, uint64(_v))
+	case uint16:
+		writeMsgpackUint(w, uint64(_v))
+	case uint32:
+		writeMsgpackUint(w, uint64(_v))
+	case uint64:
+		writeMsgpackUint(w, _v)
+	case float32:
+		w.WriteByte(0xca)
+		writeMsgpackUint32(w, math.Float32bits(_v))
+	case float64:
+		w.WriteByte(0xcb)
+		writeMsgpackUint64(w, math.Float64bits(_v))
+	case string:
+		writeMsgpackString(w, _v)
+	case []byte:
+		writeMsgpackBinary(w, _v)
+	case time.Time:
+		writeMsgpackTime(w, _v)
+	case time.Duration:
+		w.WriteByte(0xd7)
+		w.WriteByte(MsgpackExtDuration)
+		writeMsgpackUint64(w, uint64(_v))
+	case *fieldList:
+		return writeMsgpackFields(w, _v)
+	case []interface{}:
+		writeMsgpackArrayHeader(w, len(_v))
+		for _, e := range _v {
+			if err = writeMsgpackValue(w, e); err != nil {
+				return
+			}
+		}
+	case map[string]interface{}:
+		writeMsgpackMapHeader(w, len(_v))
+		for k, e := range _v {
+			writeMsgpackString(w, k)
+			if err = writeMsgpackValue(w, e); err != nil {
+				return
+			}
+		}
+	case error:
+		writeMsgpackString(w, _v.Error())
+	case fmt.Stringer:
+		writeMsgpackString(w, _v.String())
+	default:
+		var bs []byte
+		if bs, err = json.Marshal(v); err != nil {
+			return
+		}
+		writeMsgpackExtHeader(w, len(bs), MsgpackExtJSON)
+		w.Write(bs)
+	}
+	return
+}
+
+func writeMsgpackInt(w *bytes.Buffer, i int64) {
+	switch {
+	case i >= -32 && i <= 127:
+		w.WriteByte(byte(i))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		w.WriteByte(0xd0)
+		w.WriteByte(byte(i))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		w.WriteByte(0xd1)
+		writeMsgpackUint16(w, uint16(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		w.WriteByte(0xd2)
+		writeMsgpackUint32(w, uint32(i))
+	default:
+		w.WriteByte(0xd3)
+		writeMsgpackUint64(w, uint64(i))
+	}
+}
+
+func writeMsgpackUint(w *bytes.Buffer, u uint64) {
+	switch {
+	case u <= math.MaxUint8:
+		w.WriteByte(0xcc)
+		w.WriteByte(byte(u))
+	case u <= math.MaxUint16:
+		w.WriteByte(0xcd)
+		writeMsgpackUint16(w, uint16(u))
+	case u <= math.MaxUint32:
+		w.WriteByte(0xce)
+		writeMsgpackUint32(w, uint32(u))
+	default:
+		w.WriteByte(0xcf)
+		writeMsgpackUint64(w, u)
+	}
+}
+
+func writeMsgpackString(w *bytes.Buffer, s string) {
+	switch n := len(s); {
+	case n < 32:
+		w.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		w.WriteByte(0xd9)
+		w.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		w.WriteByte(0xda)
+		writeMsgpackUint16(w, uint16(n))
+	default:
+		w.WriteByte(0xdb)
+		writeMsgpackUint32(w, uint32(n))
+	}
+	w.WriteString(s)
+}
+
+func writeMsgpackBinary(w *bytes.Buffer, b []byte) {
+	switch n := len(b); {
+	case n <= math.MaxUint8:
+		w.WriteByte(0xc4)
+		w.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		w.WriteByte(0xc5)
+		writeMsgpackUint16(w, uint16(n))
+	default:
+		w.WriteByte(0xc6)
+		writeMsgpackUint32(w, uint32(n))
+	}
+	w.Write(b)
+}
+
+func writeMsgpackTime(w *bytes.Buffer, t time.Time) {
+	sec, nsec := t.Unix(), int64(t.Nanosecond())
+	switch {
+	case sec >= 0 && sec < 1<<32 && nsec == 0:
+		w.WriteByte(0xd6)
+		w.WriteByte(0xff)
+		writeMsgpackUint32(w, uint32(sec))
+	case sec >= 0 && sec < 1<<34:
+		w.WriteByte(0xd7)
+		w.WriteByte(0xff)
+		writeMsgpackUint64(w, uint64(nsec)<<34|uint64(sec))
+	default:
+		w.WriteByte(0xc7)
+		w.WriteByte(12)
+		w.WriteByte(0xff)
+		writeMsgpackUint32(w, uint32(nsec))
+		writeMsgpackUint64(w, uint64(sec))
+	}
+}
+
+func writeMsgpackMapHeader(w *bytes.Buffer, n int) {
+	switch {
+	case n < 16:
+		w.WriteByte(0x80 | byte(n))
+	case n <= math.MaxUint16:
+		w.WriteByte(0xde)
+		writeMsgpackUint16(w, uint16(n))
+	default:
+		w.WriteByte(0xdf)
+		writeMsgpackUint32(w, uint32(n))
+	}
+}
+
+func writeMsgpackArrayHeader(w *bytes.Buffer, n int) {
+	switch {
+	case n < 16:
+		w.WriteByte(0x90 | byte(n))
+	case n <= math.MaxUint16:
+		w.WriteByte(0xdc)
+		writeMsgpackUint16(w, uint16(n))
+	default:
+		w.WriteByte(0xdd)
+		writeMsgpackUint32(w, uint32(n))
+	}
+}
+
+func writeMsgpackExtHeader(w *bytes.Buffer, n int, typ int8) {
+	switch {
+	case n <= math.MaxUint8:
+		w.WriteByte(0xc7)
+		w.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		w.WriteByte(0xc8)
+		writeMsgpackUint16(w, uint16(n))
+	default:
+		w.WriteByte(0xc9)
+		writeMsgpackUint32(w, uint32(n))
+	}
+	w.WriteByte(byte(typ))
+}
+
+func writeMsgpackUint16(w *bytes.Buffer, u uint16) {
+	w.WriteByte(byte(u >> 8))
+	w.WriteByte(byte(u))
+}
+
+func writeMsgpackUint32(w *bytes.Buffer, u uint32) {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], u)
+	w.Write(buf[:])
+}
+
+func writeMsgpackUint64(w *bytes.Buffer, u uint64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], u)
+	w.Write(buf[:])
+}
@@ -0,0 +1,281 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/xgfone/go-tools/json2"
+)
+
+// CollisionPolicy is the policy to handle the key collision
+// between the fields of the log record.
+type CollisionPolicy int
+
+// Predefine some collision policies.
+const (
+	// CollisionOverwrite overwrites the value of the former key by the latter.
+	CollisionOverwrite CollisionPolicy = iota
+
+	// CollisionKeepFirst keeps the value of the former key
+	// and discards the latter.
+	CollisionKeepFirst
+
+	// CollisionSuffix keeps all the values and appends the suffix "_N"
+	// to the duplicate key, such as "key_1", "key_2", etc.
+	CollisionSuffix
+
+	// CollisionNest moves all the fields from the contexts and the arguments
+	// under a nested object, so that they never collide with the reserved
+	// keys, such as time, level and msg. The duplicate keys in the nested
+	// object are handled by CollisionOverwrite.
+	CollisionNest
+)
+
+// Group is a group of key-value pairs, which will be nested under the key
+// when it is used as the value of a key-value pair. For example,
+//
+//     logger.Info("request", "http", Group{"method", "GET", "status", 200})
+//
+// The JSON encoders will output it as {"http":{"method":"GET","status":200}},
+// and the text encoders will output it as "http.method=GET http.status=200".
+//
+// The groups with the same key in the same level will be merged.
+type Group []interface{}
+
+// groupKey is the key of the key-value pair added by WithGroup, the value
+// of which is the name of the group. All the subsequent key-value pairs,
+// including the arguments, will be nested under the group.
+type groupKey struct{}
+
+// field is a key-value pair of the log record.
+type field struct {
+	Key   string
+	Value interface{}
+}
+
+// fieldList is an ordered list of the fields, the value of which may be
+// another *fieldList representing a nested object.
+type fieldList struct {
+	fields []field
+}
+
+var fieldListPool = sync.Pool{New: func() interface{} {
+	return &fieldList{fields: make([]field, 0, 16)}
+}}
+
+func getFieldList() *fieldList {
+	return fieldListPool.Get().(*fieldList)
+}
+
+func putFieldList(l *fieldList) {
+	for i := range l.fields {
+		if sub, ok := l.fields[i].Value.(*fieldList); ok {
+			putFieldList(sub)
+		}
+		l.fields[i] = field{}
+	}
+	l.fields = l.fields[:0]
+	fieldListPool.Put(l)
+}
+
+func (l *fieldList) index(key string) int {
+	for i := range l.fields {
+		if l.fields[i].Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// set adds the key-value pair into the list by the collision policy,
+// and reports whether the value has been added.
+func (l *fieldList) set(policy CollisionPolicy, key string, value interface{}) bool {
+	index := l.index(key)
+	if index < 0 {
+		l.fields = append(l.fields, field{Key: key, Value: value})
+		return true
+	}
+
+	switch policy {
+	case CollisionKeepFirst:
+		return false
+	case CollisionSuffix:
+		for i := 1; ; i++ {
+			if _key := key + "_" + strconv.Itoa(i); l.index(_key) < 0 {
+				l.fields = append(l.fields, field{Key: _key, Value: value})
+				return true
+			}
+		}
+	default:
+		if sub, ok := l.fields[index].Value.(*fieldList); ok {
+			putFieldList(sub)
+		}
+		l.fields[index].Value = value
+		return true
+	}
+}
+
+// group returns the nested list named key, which will be created
+// if it does not exist.
+//
+// Return nil if the key has been used by a non-group value and the policy
+// does not allow to add it again.
+func (l *fieldList) group(policy CollisionPolicy, key string) *fieldList {
+	if index := l.index(key); index > -1 {
+		if sub, ok := l.fields[index].Value.(*fieldList); ok {
+			return sub
+		}
+	}
+
+	sub := getFieldList()
+	if !l.set(policy, key, sub) {
+		putFieldList(sub)
+		return nil
+	}
+	return sub
+}
+
+// compact removes the empty groups recursively.
+func (l *fieldList) compact() {
+	fields := l.fields[:0]
+	for _, f := range l.fields {
+		if sub, ok := f.Value.(*fieldList); ok {
+			if sub.compact(); len(sub.fields) == 0 {
+				putFieldList(sub)
+				continue
+			}
+		}
+		fields = append(fields, f)
+	}
+	for i := len(fields); i < len(l.fields); i++ {
+		l.fields[i] = field{}
+	}
+	l.fields = fields
+}
+
+// toMap converts the field list to a map recursively.
+func (l *fieldList) toMap() map[string]interface{} {
+	maps := make(map[string]interface{}, len(l.fields))
+	for _, f := range l.fields {
+		if sub, ok := f.Value.(*fieldList); ok {
+			maps[f.Key] = sub.toMap()
+		} else {
+			maps[f.Key] = f.Value
+		}
+	}
+	return maps
+}
+
+// setReservedFields adds the reserved fields of the JSON encoders into l
+// in order, that's, time, level, name and msg, which are ignored
+// if their valuers do not exist.
+func setReservedFields(r Record, l *fieldList, c *JSONEncoderConfig) {
+	r.Depth++
+	if f, ok := c.Valuers[c.TimeKey]; ok {
+		now, _ := f(r)
+		l.set(c.Collision, c.TimeKey, now)
+	}
+	if f, ok := c.Valuers[c.LevelKey]; ok {
+		lvl, _ := f(r)
+		l.set(c.Collision, c.LevelKey, lvl)
+	}
+	if f, ok := c.Valuers[c.NameKey]; ok {
+		name, _ := f(r)
+		l.set(c.Collision, c.NameKey, name)
+	}
+	l.set(c.Collision, c.MsgKey, r.Msg)
+}
+
+// collectFields evaluates the contexts and the arguments of the record,
+// then adds them into l by the policy.
+//
+// If the policy is CollisionNest, they will be added into the nested object
+// named nestKey.
+func collectFields(r Record, l *fieldList, policy CollisionPolicy,
+	nestKey string) (err error) {
+
+	if len(r.Args)%2 != 0 || len(r.Ctxs)%2 != 0 {
+		return ErrKeyValueNum
+	}
+
+	r.Depth++
+	fields := l
+	if policy == CollisionNest {
+		fields = getFieldList()
+	}
+
+	// The group opened by WithGroup in the contexts contains the arguments.
+	var cur *fieldList
+	if cur, err = addFields(r, fields, policy, r.Ctxs); err == nil {
+		_, err = addFields(r, cur, policy, r.Args)
+	}
+
+	if fields != l {
+		if err != nil || len(fields.fields) == 0 {
+			putFieldList(fields)
+		} else {
+			l.set(CollisionOverwrite, nestKey, fields)
+		}
+	}
+
+	if err == nil {
+		l.compact()
+	}
+	return
+}
+
+// addFields adds the key-value pairs into l, and returns the list that
+// the subsequent key-value pairs should be added into.
+//
+// If l is nil, the key-value pairs will be discarded.
+func addFields(r Record, l *fieldList, policy CollisionPolicy,
+	kvs []interface{}) (cur *fieldList, err error) {
+
+	r.Depth++
+	cur = l
+	var k, v interface{}
+	for i, _len := 0, len(kvs); i < _len; i += 2 {
+		if cur == nil {
+			return
+		}
+
+		if _, ok := kvs[i].(groupKey); ok {
+			cur = cur.group(policy, json2.ToString(kvs[i+1]))
+			continue
+		}
+
+		if k, err = MayBeValuer(r, kvs[i]); err != nil {
+			return
+		}
+		if v, err = MayBeValuer(r, kvs[i+1]); err != nil {
+			return
+		}
+
+		if g, ok := v.(Group); ok {
+			if len(g)%2 != 0 {
+				return nil, ErrKeyValueNum
+			}
+			if _, err = addFields(r, cur.group(policy, json2.ToString(k)), policy, g); err != nil {
+				return
+			}
+			continue
+		}
+
+		cur.set(policy, json2.ToString(k), v)
+	}
+	return
+}
@@ -0,0 +1,55 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func ExampleGroup() {
+	// Only for test to replace the `time` context.
+	valuers := map[string]Valuer{"time": func(r Record) (interface{}, error) { return "2019-05-16T17:29:12Z", nil }}
+
+	conf := JSONEncoderConfig{Valuers: valuers}
+	log1 := LoggerWithGroup(New(NewStreamJSONEncoder(os.Stdout, conf)).WithCxt("id", 1), "http")
+	log1.WithName("web").WithCxt("method", "GET").Info("request", "status", 200)
+	log1.Info("request", "tcp", Group{"port", 80, "caller", Caller()})
+
+	log2 := LoggerWithGroup(New(NewTextJSONEncoder(os.Stdout, conf)).WithCxt("id", 1), "http")
+	log2.WithCxt("method", "GET").Info("request", "status", 200)
+
+	log3 := New(NewFmtEncoder(os.Stdout, FmtEncoderConfig{Tmpl: "{ctx}: {msg}"}))
+	LoggerWithGroup(log3.WithCxt("id", Group{"a", 1}), "http").WithCxt("method", "GET").Info("request")
+
+	// Output:
+	// {"time":"2019-05-16T17:29:12Z","level":"INFO","name":"web","msg":"request","id":1,"http":{"method":"GET","status":200}}
+	// {"time":"2019-05-16T17:29:12Z","level":"INFO","name":"root","msg":"request","id":1,"http":{"tcp":{"port":80,"caller":"field_test.go:30"}}}
+	// time=2019-05-16T17:29:12Z level=INFO id=1 http.method=GET http.status=200 msg=request
+	// id.a=1|http.method=GET: request
+}
+
+func TestGroupMerge(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	conf := JSONEncoderConfig{TimeKey: "-", LevelKey: "-", NameKey: "-"}
+	log := New(NewStreamJSONEncoder(buf, conf)).WithCxt("http", Group{"method", "GET"})
+	log.Info("msg", "http", Group{"status", 200})
+	LoggerWithGroup(log, "empty").Info("msg")
+	expected := `{"msg":"msg","http":{"method":"GET","status":200}}` + "\n" + `{"msg":"msg","http":{"method":"GET"}}` + "\n"
+	if s := buf.String(); s != expected {
+		t.Error(s)
+	}
+}
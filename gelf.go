@@ -0,0 +1,328 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xgfone/go-tools/json2"
+)
+
+// GELFEncoderConfig is used to configure the GELF encoder.
+type GELFEncoderConfig struct {
+	// The name of the host sending the log, which is os.Hostname() by default.
+	Host string
+
+	// If true, output the logger name as the additional field "_logger".
+	WithName bool
+}
+
+// NewGELFEncoder returns a new encoder based on Graylog Extended Log Format 1.1,
+// which outputs the log as follow:
+//
+//     {"version":"1.1","host":"localhost","short_message":"msg","timestamp":1558027752.12,"level":6,"_key":"value"}
+//
+// The level is mapped to the severity number of syslog by Level.SyslogSeverity.
+// short_message is the first line of the message, and full_message is
+// the whole message only if it has more than one line.
+//
+// The fields from the contexts and the arguments are prefixed with "_",
+// the keys of the nested objects are joined by ".", and any character which
+// is not allowed by GELF is replaced with "_". The numbers are output as they
+// are, and others are converted to the strings. Because "_id" is reserved,
+// it will be renamed to "__id".
+//
+// It does not append a newline, so it should be used with GELFWriter.
+//
+// Notice: This encoder supports LevelWriter.
+func NewGELFEncoder(out Writer, conf ...GELFEncoderConfig) Encoder {
+	var c GELFEncoderConfig
+	if len(conf) > 0 {
+		c = conf[0]
+	}
+	if c.Host == "" {
+		if c.Host, _ = os.Hostname(); c.Host == "" {
+			c.Host = "localhost"
+		}
+	}
+
+	return EncoderFunc(out, func(out Writer, r Record) (err error) {
+		r.Depth++
+		userFields := getFieldList()
+		defer putFieldList(userFields)
+		if err = collectFields(r, userFields, CollisionOverwrite, ""); err != nil {
+			return
+		}
+
+		fields := getFieldList()
+		defer putFieldList(fields)
+
+		short := r.Msg
+		if index := strings.IndexByte(short, '\n'); index > -1 {
+			short = short[:index]
+		}
+
+		fields.set(CollisionOverwrite, "version", "1.1")
+		fields.set(CollisionOverwrite, "host", c.Host)
+		fields.set(CollisionOverwrite, "short_message", short)
+		if len(short) != len(r.Msg) {
+			fields.set(CollisionOverwrite, "full_message", r.Msg)
+		}
+		fields.set(CollisionOverwrite, "timestamp",
+			float64(r.now().UnixNano()/int64(time.Millisecond))/1000)
+		fields.set(CollisionOverwrite, "level", r.Lvl.SyslogSeverity())
+		if c.WithName {
+			fields.set(CollisionOverwrite, "_logger", r.Name)
+		}
+		flattenGELFFields(fields, "", userFields)
+
+		w := DefaultBufferPool.Get()
+		defer DefaultBufferPool.Put(w)
+
+		if err = writeJSONObject(w, fields); err != nil {
+			return
+		}
+		_, err = MayWriteLevel(out, r.Lvl, w.Bytes())
+		return
+	})
+}
+
+func flattenGELFFields(dst *fieldList, prefix string, src *fieldList) {
+	for _, f := range src.fields {
+		key := prefix + f.Key
+		if sub, ok := f.Value.(*fieldList); ok {
+			flattenGELFFields(dst, key+".", sub)
+			continue
+		}
+
+		key = "_" + gelfFieldName(key)
+		if key == "_id" {
+			key = "__id"
+		}
+
+		switch v := f.Value.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32,
+			uint64, float32, float64, string:
+			dst.set(CollisionOverwrite, key, v)
+		case time.Time:
+			dst.set(CollisionOverwrite, key, v.Format(time.RFC3339Nano))
+		default:
+			dst.set(CollisionOverwrite, key, json2.ToString(v))
+		}
+	}
+}
+
+// gelfFieldName replaces the characters not matching [\w\.\-] with '_'.
+func gelfFieldName(name string) string {
+	for i := 0; i < len(name); i++ {
+		if !isGELFFieldChar(name[i]) {
+			bs := []byte(name)
+			for j := i; j < len(bs); j++ {
+				if !isGELFFieldChar(bs[j]) {
+					bs[j] = '_'
+				}
+			}
+			return string(bs)
+		}
+	}
+	return name
+}
+
+func isGELFFieldChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '.' || c == '-'
+}
+
+// GELFCompression is the compression type of the GELF message over UDP.
+type GELFCompression int
+
+// Predefine some GELF compression types.
+const (
+	GELFCompressGzip GELFCompression = iota
+	GELFCompressZlib
+	GELFCompressNone
+)
+
+// Some constants about the GELF chunks.
+const (
+	GELFMaxChunkSize     = 8192
+	GELFDefaultChunkSize = 1420
+	gelfMaxChunkCount    = 128
+	gelfChunkHeaderSize  = 12
+)
+
+// ErrGELFTooManyChunks is returned when the GELF message is split into
+// more than 128 chunks.
+var ErrGELFTooManyChunks = fmt.Errorf("the GELF message has too many chunks")
+
+// GELFWriterConfig is used to configure the GELF writer.
+type GELFWriterConfig struct {
+	// The compression type of the message over UDP, which is gzip by default.
+	//
+	// Notice: GELF over TCP does not support the compression,
+	// so it's ignored for TCP.
+	Compression GELFCompression
+
+	// The compression level of gzip or zlib, which is the default of them.
+	CompressionLevel int
+
+	// The maximum size of the UDP packet including the chunk header,
+	// which is GELFDefaultChunkSize by default and must not be greater
+	// than GELFMaxChunkSize.
+	ChunkSize int
+}
+
+// GELFWriter opens a socket to the given address, and writes the GELF message
+// over the connection, the network of which may be "udp" or "tcp".
+//
+// Every call of Write is considered as a GELF message. For UDP, the message
+// is compressed and split into the GELF chunks if it's too big. For TCP,
+// the message is framed by the null byte.
+//
+// It is thread-safe for concurrent writes.
+func GELFWriter(network, addr string, conf ...GELFWriterConfig) (Writer, io.Closer, error) {
+	var c GELFWriterConfig
+	if len(conf) > 0 {
+		c = conf[0]
+	}
+	if c.ChunkSize <= gelfChunkHeaderSize || c.ChunkSize > GELFMaxChunkSize {
+		c.ChunkSize = GELFDefaultChunkSize
+	}
+	if c.CompressionLevel == 0 {
+		c.CompressionLevel = -1
+	}
+
+	var tcp bool
+	switch network {
+	case "udp", "udp4", "udp6":
+	case "tcp", "tcp4", "tcp6":
+		tcp = true
+	default:
+		return nil, nil, fmt.Errorf("GELF does not support the network '%s'", network)
+	}
+
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w := &gelfWriter{conn: conn, conf: c, tcp: tcp}
+	if _, err = io.ReadFull(rand.Reader, w.idPrefix[:]); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return w, conn, nil
+}
+
+type gelfWriter struct {
+	sync.Mutex
+	conn net.Conn
+	conf GELFWriterConfig
+	tcp  bool
+
+	buf      bytes.Buffer
+	idPrefix [4]byte
+	idCount  uint32
+}
+
+func (w *gelfWriter) Write(p []byte) (n int, err error) {
+	w.Lock()
+	defer w.Unlock()
+
+	w.buf.Reset()
+	if w.tcp {
+		w.buf.Write(p)
+		w.buf.WriteByte(0)
+		if _, err = w.conn.Write(w.buf.Bytes()); err != nil {
+			return
+		}
+		return len(p), nil
+	}
+
+	if err = w.compress(p); err != nil {
+		return
+	}
+	if err = w.writeUDP(w.buf.Bytes()); err != nil {
+		return
+	}
+	return len(p), nil
+}
+
+func (w *gelfWriter) compress(p []byte) (err error) {
+	var cw io.WriteCloser
+	switch w.conf.Compression {
+	case GELFCompressGzip:
+		cw, err = gzip.NewWriterLevel(&w.buf, w.conf.CompressionLevel)
+	case GELFCompressZlib:
+		cw, err = zlib.NewWriterLevel(&w.buf, w.conf.CompressionLevel)
+	default:
+		_, err = w.buf.Write(p)
+		return
+	}
+
+	if err != nil {
+		return
+	}
+	if _, err = cw.Write(p); err != nil {
+		cw.Close()
+		return
+	}
+	return cw.Close()
+}
+
+func (w *gelfWriter) writeUDP(data []byte) (err error) {
+	if len(data) <= w.conf.ChunkSize {
+		_, err = w.conn.Write(data)
+		return
+	}
+
+	size := w.conf.ChunkSize - gelfChunkHeaderSize
+	count := (len(data) + size - 1) / size
+	if count > gelfMaxChunkCount {
+		return ErrGELFTooManyChunks
+	}
+
+	w.idCount++
+	var chunk [GELFMaxChunkSize]byte
+	chunk[0], chunk[1] = 0x1e, 0x0f
+	copy(chunk[2:6], w.idPrefix[:])
+	binary.BigEndian.PutUint32(chunk[6:10], w.idCount)
+	chunk[11] = byte(count)
+
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(data) {
+			end = len(data)
+		}
+
+		chunk[10] = byte(i)
+		n := copy(chunk[gelfChunkHeaderSize:], data[i*size:end])
+		if _, err = w.conn.Write(chunk[:gelfChunkHeaderSize+n]); err != nil {
+			return
+		}
+	}
+	return
+}
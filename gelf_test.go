@@ -0,0 +1,151 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readGELFMessage(conn net.PacketConn) ([]byte, error) {
+	var chunks [][]byte
+	var count int
+	buf := make([]byte, GELFMaxChunkSize)
+	for {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		packet := append([]byte(nil), buf[:n]...)
+		if packet[0] != 0x1e || packet[1] != 0x0f {
+			return packet, nil
+		}
+
+		if chunks == nil {
+			count = int(packet[11])
+			chunks = make([][]byte, count)
+		}
+		chunks[packet[10]] = packet[gelfChunkHeaderSize:]
+		if count--; count == 0 {
+			return bytes.Join(chunks, nil), nil
+		}
+	}
+}
+
+func TestGELFWriter(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w, c, err := GELFWriter("udp", conn.LocalAddr().String(),
+		GELFWriterConfig{ChunkSize: 64, CompressionLevel: gzip.NoCompression})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	log := New(NewGELFEncoder(w, GELFEncoderConfig{Host: "localhost"}))
+	log.Info("first line\nsecond line", "id", 123, "http", Group{"method", "GET"},
+		"invalid key", true)
+
+	data, err := readGELFMessage(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) <= 64 {
+		t.Errorf("the message is not chunked: %d", len(data))
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err = ioutil.ReadAll(gr); err != nil {
+		t.Fatal(err)
+	}
+
+	var msg map[string]interface{}
+	if err = json.Unmarshal(data, &msg); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"version":       "1.1",
+		"host":          "localhost",
+		"short_message": "first line",
+		"full_message":  "first line\nsecond line",
+		"level":         float64(6),
+		"__id":          float64(123),
+		"_http.method":  "GET",
+		"_invalid_key":  "true",
+	}
+	for k, v := range expected {
+		if msg[k] != v {
+			t.Errorf("%s: expected '%v', but got '%v'", k, v, msg[k])
+		}
+	}
+	if _, ok := msg["timestamp"].(float64); !ok {
+		t.Errorf("invalid timestamp: %v", msg["timestamp"])
+	}
+}
+
+func TestGELFWriterTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	w, c, err := GELFWriter("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w.Write([]byte(`{"short_message":"msg1"}`))
+	w.Write([]byte(`{"short_message":"msg2"}`))
+
+	var data []byte
+	buf := make([]byte, 1024)
+	for strings.Count(string(data), "\x00") < 2 {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, buf[:n]...)
+	}
+
+	expected := "{\"short_message\":\"msg1\"}\x00{\"short_message\":\"msg2\"}\x00"
+	if string(data) != expected {
+		t.Errorf("expected '%q', but got '%q'", expected, data)
+	}
+}
@@ -111,6 +111,17 @@ func WithCxt(ctxs ...interface{}) Logger {
 	return root.WithCxt(ctxs...)
 }
 
+// WithGroup returns a new logger with the group, under which all the
+// subsequent contexts and arguments will be nested.
+func WithGroup(name string) Logger {
+	return LoggerWithGroup(root, name)
+}
+
+// WithClock returns a new logger with the clock.
+func WithClock(clock Clock) Logger {
+	return LoggerWithClock(root, clock)
+}
+
 // WithDepth returns a new logger with the caller depth.
 func WithDepth(depth int) Logger {
 	return root.WithDepth(depth)
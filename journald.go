@@ -0,0 +1,183 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xgfone/go-tools/json2"
+)
+
+// JournaldEncoderConfig is used to configure the journald encoder.
+type JournaldEncoderConfig struct {
+	// The value of the field SYSLOG_IDENTIFIER, which is the base name
+	// of os.Args[0] by default.
+	Identifier string
+
+	// Severity maps the level to the field PRIORITY,
+	// which is Level.SyslogSeverity by default.
+	Severity func(Level) int
+
+	// If true, the encoder won't output the fields CODE_FILE, CODE_LINE
+	// and CODE_FUNC.
+	NoCaller bool
+}
+
+// NewJournaldEncoder returns a new encoder based on the native protocol
+// of systemd-journald, which outputs the log as follow:
+//
+//     PRIORITY=6
+//     MESSAGE=msg
+//     SYSLOG_IDENTIFIER=app
+//     CODE_FILE=/path/to/main.go
+//     CODE_LINE=12
+//     CODE_FUNC=main.main
+//     KEY=value
+//
+// The keys from the contexts and the arguments are converted to the upper
+// case, the keys of the nested groups are joined by "_", and any character
+// which is not allowed by journald is replaced with '_'. Because the leading
+// underscores are reserved by journald, they are removed, and the key is
+// prefixed with "F_" if it is empty or starts with a digit. The key is also
+// prefixed with "F_" if it is the same as the field output by the encoder
+// itself, such as MESSAGE and PRIORITY, for example, "F_MESSAGE".
+//
+// The value containing the newline is serialized by the binary format,
+// that's, the key, a newline, the 64-bit little-endian size and the value.
+//
+// It should be used with JournaldWriter.
+//
+// Notice: This encoder supports LevelWriter.
+func NewJournaldEncoder(out Writer, conf ...JournaldEncoderConfig) Encoder {
+	var c JournaldEncoderConfig
+	if len(conf) > 0 {
+		c = conf[0]
+	}
+	if c.Identifier == "" && len(os.Args) > 0 {
+		c.Identifier = filepath.Base(os.Args[0])
+	}
+	if c.Severity == nil {
+		c.Severity = Level.SyslogSeverity
+	}
+
+	return EncoderFunc(out, func(out Writer, r Record) (err error) {
+		r.Depth++
+		fields := getFieldList()
+		defer putFieldList(fields)
+		if err = collectFields(r, fields, CollisionOverwrite, ""); err != nil {
+			return
+		}
+
+		w := DefaultBufferPool.Get()
+		defer DefaultBufferPool.Put(w)
+
+		writeJournaldField(w, "PRIORITY", strconv.Itoa(c.Severity(r.Lvl)))
+		writeJournaldField(w, "MESSAGE", r.Msg)
+		if c.Identifier != "" {
+			writeJournaldField(w, "SYSLOG_IDENTIFIER", c.Identifier)
+		}
+		if !c.NoCaller {
+			writeJournaldField(w, "CODE_FILE", r.LongFileName())
+			writeJournaldField(w, "CODE_LINE", r.Line())
+			writeJournaldField(w, "CODE_FUNC", r.QualifiedFuncName())
+		}
+		writeJournaldFields(w, "", fields)
+
+		_, err = MayWriteLevel(out, r.Lvl, w.Bytes())
+		return
+	})
+}
+
+func writeJournaldFields(w *bytes.Buffer, prefix string, l *fieldList) {
+	for _, f := range l.fields {
+		if sub, ok := f.Value.(*fieldList); ok {
+			writeJournaldFields(w, prefix+f.Key+"_", sub)
+			continue
+		}
+
+		var value string
+		switch v := f.Value.(type) {
+		case string:
+			value = v
+		case []byte:
+			value = string(v)
+		case time.Time:
+			value = v.Format(time.RFC3339Nano)
+		default:
+			value = json2.ToString(v)
+		}
+		name := journaldFieldName(prefix + f.Key)
+		if _, ok := journaldReservedFields[name]; ok {
+			name = "F_" + name
+		}
+		writeJournaldField(w, name, value)
+	}
+}
+
+// journaldReservedFields is the fields output by the journald encoder itself.
+var journaldReservedFields = map[string]struct{}{
+	"PRIORITY":          {},
+	"MESSAGE":           {},
+	"SYSLOG_IDENTIFIER": {},
+	"CODE_FILE":         {},
+	"CODE_LINE":         {},
+	"CODE_FUNC":         {},
+}
+
+func writeJournaldField(w *bytes.Buffer, key, value string) {
+	w.WriteString(key)
+	if strings.IndexByte(value, '\n') < 0 {
+		w.WriteByte('=')
+		w.WriteString(value)
+	} else {
+		var size [8]byte
+		binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+		w.WriteByte('\n')
+		w.Write(size[:])
+		w.WriteString(value)
+	}
+	w.WriteByte('\n')
+}
+
+// journaldFieldName returns the valid field name of journald, which only
+// contains the upper case letters, the digits and the underscores, does not
+// start with the underscore or the digit, and is not longer than 64.
+func journaldFieldName(key string) string {
+	bs := make([]byte, 0, len(key)+2)
+	for i := 0; i < len(key); i++ {
+		switch c := key[i]; {
+		case c >= 'a' && c <= 'z':
+			bs = append(bs, c-'a'+'A')
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+			bs = append(bs, c)
+		case len(bs) > 0:
+			bs = append(bs, '_')
+		}
+	}
+
+	if len(bs) == 0 || (bs[0] >= '0' && bs[0] <= '9') {
+		bs = append([]byte("F_"), bs...)
+	}
+	if len(bs) > 64 {
+		bs = bs[:64]
+	}
+	return string(bs)
+}
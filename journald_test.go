@@ -0,0 +1,177 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build linux
+
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func parseJournaldEntry(data []byte) map[string]string {
+	fields := make(map[string]string)
+	for len(data) > 0 {
+		index := bytes.IndexAny(data, "=\n")
+		key := string(data[:index])
+		if data[index] == '=' {
+			data = data[index+1:]
+			end := bytes.IndexByte(data, '\n')
+			fields[key] = string(data[:end])
+			data = data[end+1:]
+		} else {
+			size := int(binary.LittleEndian.Uint64(data[index+1:]))
+			data = data[index+9:]
+			fields[key] = string(data[:size])
+			data = data[size+1:]
+		}
+	}
+	return fields
+}
+
+func listenJournald(t *testing.T) (*net.UnixConn, string, func()) {
+	dir, err := ioutil.TempDir("", "journald")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return conn, path, func() { conn.Close(); os.RemoveAll(dir) }
+}
+
+func TestJournaldWriter(t *testing.T) {
+	conn, path, cleanup := listenJournald(t)
+	defer cleanup()
+
+	w, c, err := JournaldWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	conf := JournaldEncoderConfig{Identifier: "app"}
+	log := New(NewJournaldEncoder(w, conf))
+	log.Error("msg", "http", Group{"method", "GET"}, "_id", 1, "stack", "line1\nline2")
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := parseJournaldEntry(buf[:n])
+	expected := map[string]string{
+		"PRIORITY":          "3",
+		"MESSAGE":           "msg",
+		"SYSLOG_IDENTIFIER": "app",
+		"CODE_FUNC":         "github.com/xgfone/logger.TestJournaldWriter",
+		"HTTP_METHOD":       "GET",
+		"ID":                "1",
+		"STACK":             "line1\nline2",
+	}
+	for k, v := range expected {
+		if fields[k] != v {
+			t.Errorf("%s: expected '%s', but got '%s'", k, v, fields[k])
+		}
+	}
+	if !strings.HasSuffix(fields["CODE_FILE"], "journald_test.go") {
+		t.Errorf("unexpected CODE_FILE '%s'", fields["CODE_FILE"])
+	}
+}
+
+func TestJournaldWriterLargeEntry(t *testing.T) {
+	conn, path, cleanup := listenJournald(t)
+	defer cleanup()
+
+	w, c, err := JournaldWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	entry := "MESSAGE=" + strings.Repeat("a", 4*1024*1024) + "\n"
+	if _, err = w.Write([]byte(entry)); err != nil {
+		t.Fatal(err)
+	}
+
+	oob := make([]byte, syscall.CmsgSpace(4))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, oobn, _, _, err := conn.ReadMsgUnix(nil, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("no file descriptor: %v", err)
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		t.Fatalf("no file descriptor: %v", err)
+	}
+
+	f := os.NewFile(uintptr(fds[0]), "journald")
+	defer f.Close()
+	if _, err = f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(data) != entry {
+		t.Errorf("the entry size is %d, but got %d", len(entry), len(data))
+	}
+}
+
+func TestJournaldEncoderReservedFields(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := New(NewJournaldEncoder(buf, JournaldEncoderConfig{Identifier: "app"}))
+	log.Info("msg", "message", "user", "priority", 1, "code_file", "file",
+		"syslog_identifier", "id", "http", Group{"message", "nested"})
+
+	fields := parseJournaldEntry(buf.Bytes())
+	expected := map[string]string{
+		"MESSAGE":             "msg",
+		"PRIORITY":            "6",
+		"SYSLOG_IDENTIFIER":   "app",
+		"F_MESSAGE":           "user",
+		"F_PRIORITY":          "1",
+		"F_CODE_FILE":         "file",
+		"F_SYSLOG_IDENTIFIER": "id",
+		"HTTP_MESSAGE":        "nested",
+	}
+	for key, value := range expected {
+		if fields[key] != value {
+			t.Errorf("%s: expect '%s', but got '%s'", key, value, fields[key])
+		}
+	}
+	if n := bytes.Count(buf.Bytes(), []byte("\nMESSAGE=")); n != 1 {
+		t.Errorf("expect 1 MESSAGE, but got %d", n)
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build linux
+
+package logger
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// JournaldSocket is the default native socket of systemd-journald.
+const JournaldSocket = "/run/systemd/journal/socket"
+
+// Some constants about memfd, which are not defined by the package syscall.
+const (
+	mfdCloexec      = 0x1
+	mfdAllowSealing = 0x2
+	fAddSeals       = 1033
+	fSealAll        = 0x1 | 0x2 | 0x4 | 0x8 // SEAL, SHRINK, GROW and WRITE
+)
+
+// JournaldWriter opens the native socket of systemd-journald, which is
+// JournaldSocket by default, and sends every call of Write as a journal
+// entry, which should be generated by NewJournaldEncoder.
+//
+// If the entry is too large to be sent as a datagram, it will be written
+// into a sealed memfd, or an unlinked temporary file under /dev/shm
+// if memfd is not supported, and the file descriptor is passed to journald.
+//
+// It is thread-safe for concurrent writes.
+func JournaldWriter(socket ...string) (Writer, io.Closer, error) {
+	path := JournaldSocket
+	if len(socket) > 0 && socket[0] != "" {
+		path = socket[0]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, nil, err
+	}
+	return journaldWriter{conn}, conn, nil
+}
+
+type journaldWriter struct {
+	conn *net.UnixConn
+}
+
+func (w journaldWriter) Write(p []byte) (n int, err error) {
+	if _, err = w.conn.Write(p); err == nil {
+		return len(p), nil
+	} else if !isJournaldTooLarge(err) {
+		return
+	}
+
+	f, err := journaldTempFile(p)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	// WriteMsgUnix does not support the connected datagram socket,
+	// so send the file descriptor by the raw connection.
+	rc, err := w.conn.SyscallConn()
+	if err != nil {
+		return
+	}
+
+	rights := syscall.UnixRights(int(f.Fd()))
+	werr := rc.Write(func(fd uintptr) bool {
+		err = syscall.Sendmsg(int(fd), nil, rights, nil, 0)
+		return err != syscall.EAGAIN
+	})
+	if werr != nil {
+		return 0, werr
+	} else if err != nil {
+		return 0, os.NewSyscallError("sendmsg", err)
+	}
+	return len(p), nil
+}
+
+func isJournaldTooLarge(err error) bool {
+	if oe, ok := err.(*net.OpError); ok {
+		err = oe.Err
+	}
+	if se, ok := err.(*os.SyscallError); ok {
+		err = se.Err
+	}
+	return err == syscall.EMSGSIZE || err == syscall.ENOBUFS
+}
+
+// journaldTempFile returns a sealed memfd, or an unlinked temporary file
+// under /dev/shm, containing the data.
+func journaldTempFile(data []byte) (*os.File, error) {
+	if f, err := memfdCreate("journald"); err == nil {
+		if _, err = f.Write(data); err == nil {
+			if err = fcntl(f.Fd(), fAddSeals, fSealAll); err == nil {
+				return f, nil
+			}
+		}
+		f.Close()
+		return nil, err
+	}
+
+	f, err := ioutil.TempFile("/dev/shm", "journald-")
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Remove(f.Name()); err == nil {
+		if _, err = f.Write(data); err == nil {
+			return f, nil
+		}
+	}
+	f.Close()
+	return nil, err
+}
+
+func memfdCreate(name string) (*os.File, error) {
+	var trap uintptr
+	switch runtime.GOARCH {
+	case "amd64":
+		trap = 319
+	case "386":
+		trap = 356
+	case "arm":
+		trap = 385
+	case "arm64", "riscv64", "loong64":
+		trap = 279
+	case "ppc64", "ppc64le":
+		trap = 360
+	case "s390x":
+		trap = 350
+	case "mips64", "mips64le":
+		trap = 5314
+	case "mips", "mipsle":
+		trap = 4354
+	default:
+		return nil, syscall.ENOSYS
+	}
+
+	p, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, _, errno := syscall.Syscall(trap, uintptr(unsafe.Pointer(p)),
+		mfdCloexec|mfdAllowSealing, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	return os.NewFile(fd, name), nil
+}
+
+func fcntl(fd uintptr, cmd, arg int) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, uintptr(cmd), uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
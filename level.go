@@ -161,6 +161,26 @@ func (l Level) ShortBytes() []byte {
 	}
 }
 
+// SyslogSeverity returns the severity number of syslog for the level,
+// that's, FATAL is 0 (Emergency), PANIC is 2 (Critical), ERROR is 3 (Error),
+// WARN is 4 (Warning), INFO is 6 (Informational), and others are 7 (Debug).
+func (l Level) SyslogSeverity() int {
+	switch {
+	case l >= LvlFatal:
+		return 0
+	case l >= LvlPanic:
+		return 2
+	case l >= LvlError:
+		return 3
+	case l >= LvlWarn:
+		return 4
+	case l >= LvlInfo:
+		return 6
+	default:
+		return 7
+	}
+}
+
 // WriteTo writes the level into out.
 func (l Level) WriteTo(out Writer, short bool) (n int, err error) {
 	if short {
@@ -19,6 +19,7 @@ import (
 	"io"
 	"os"
 	"sync/atomic"
+	"time"
 
 	"github.com/xgfone/go-tools/pools"
 )
@@ -32,6 +33,25 @@ const DefaultLoggerDepth = 2
 // DefaultBufferPool is the default global buffer pool.
 var DefaultBufferPool = pools.NewBufferPool()
 
+// Clock is used to return the current time for the log record.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc converts a function to Clock.
+type ClockFunc func() time.Time
+
+// Now implements the interface Clock.
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// DefaultClock is the default clock of Logger, which returns time.Now().
+//
+// It is looked up when emitting each log by the loggers without the clock,
+// so changing it also takes effect on the loggers created before.
+var DefaultClock Clock = ClockFunc(time.Now)
+
 // LogGetter is an interface to return the inner information of Logger.
 type LogGetter interface {
 	GetName() string
@@ -58,6 +78,47 @@ type LogWither interface {
 	WithDepth(stackDepth int) Logger
 }
 
+// GroupWither is an optional interface of Logger to return a new Logger
+// with the group, which has been implemented by the built-in Logger.
+//
+// See LoggerWithGroup.
+type GroupWither interface {
+	WithGroup(name string) Logger
+}
+
+// ClockWither is an optional interface of Logger to return a new Logger
+// with the clock, which has been implemented by the built-in Logger.
+// If clock is nil, the new Logger should use DefaultClock.
+//
+// See LoggerWithClock.
+type ClockWither interface {
+	WithClock(clock Clock) Logger
+}
+
+// LoggerWithGroup returns a new logger based on logger with the group,
+// under which all the subsequent contexts and arguments will be nested.
+//
+// If logger has not implemented GroupWither, the group is added by WithCxt,
+// which is also supported by the built-in encoders.
+func LoggerWithGroup(logger Logger, name string) Logger {
+	if g, ok := logger.(GroupWither); ok {
+		return g.WithGroup(name)
+	}
+	return logger.WithCxt(groupKey{}, name)
+}
+
+// LoggerWithClock returns a new logger based on logger with the clock.
+// If clock is nil, use DefaultClock.
+//
+// If logger has not implemented ClockWither, the clock is ignored
+// and logger itself is returned, which still uses its own clock.
+func LoggerWithClock(logger Logger, clock Clock) Logger {
+	if c, ok := logger.(ClockWither); ok {
+		return c.WithClock(clock)
+	}
+	return logger
+}
+
 // LogOutputter is an interface to emit the log.
 type LogOutputter interface {
 	Trace(msg string, args ...interface{}) error
@@ -107,6 +168,7 @@ type logger struct {
 	enc Encoder
 	lvl Level
 	ctx []interface{}
+	clk Clock
 
 	name  string
 	depth int
@@ -130,6 +192,7 @@ func newLogger(l *logger) *logger {
 	return &logger{
 		enc: l.enc,
 		ctx: l.ctx,
+		clk: l.clk,
 		lvl: l.GetLevel(),
 
 		name:  l.name,
@@ -199,13 +262,29 @@ func (l *logger) WithCxt(ctxs ...interface{}) Logger {
 	return log
 }
 
+func (l *logger) WithGroup(name string) Logger {
+	return l.WithCxt(groupKey{}, name)
+}
+
+func (l *logger) WithClock(clock Clock) Logger {
+	log := newLogger(l)
+	log.clk = clock
+	return log
+}
+
 func (l *logger) log(lvl Level, msg string, args []interface{}) (err error) {
 	if lvl < l.GetLevel() {
 		return nil
 	}
 
+	clock := l.clk
+	if clock == nil {
+		clock = DefaultClock
+	}
+
 	err = l.enc.Encode(Record{
 		Lvl:   lvl,
+		Time:  clock.Now(),
 		Msg:   msg,
 		Args:  args,
 		Ctxs:  l.ctx,
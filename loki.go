@@ -0,0 +1,287 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/xgfone/go-tools/json2"
+)
+
+// LokiEncoderConfig is used to configure the Loki encoder.
+type LokiEncoderConfig struct {
+	// The label names of the logger name and the level, which are "logger"
+	// and "level" by default. If it's "-", the label won't be output.
+	//
+	// Because Loki rejects the stream without any label, the logger name
+	// is still output as the label "logger" if there is no other label.
+	NameLabel  string
+	LevelLabel string
+
+	// The keys of the contexts which are output as the labels.
+	//
+	// Only the contexts added by WithCxt out of any group are supported.
+	// Because each combination of the label values is a stream of Loki,
+	// their values should be low-cardinality.
+	CtxLabels []string
+
+	// The static labels of all the streams, such as the job or the app.
+	Labels map[string]string
+
+	// If true, the log line is the JSON object. Or it's logfmt.
+	JSONLine bool
+}
+
+// NewLokiEncoder returns a new encoder for the push API of Grafana Loki,
+// which should be used with LokiWriter.
+//
+// The logger name, the level, the contexts in conf.CtxLabels and the static
+// labels are output as the labels of the stream, and the message and other
+// fields are output as the log line, for example,
+//
+//     {"stream":{"app":"demo","logger":"http","level":"INFO"},"values":[["1558027752000000000","msg=hello key=value"]]}
+//
+// Any character of the label name, which is not allowed by Loki, is replaced
+// with '_'. And it appends a newline.
+//
+// Notice: This encoder supports LevelWriter.
+func NewLokiEncoder(out Writer, conf ...LokiEncoderConfig) Encoder {
+	var c LokiEncoderConfig
+	if len(conf) > 0 {
+		c = conf[0]
+	}
+	if c.NameLabel == "" {
+		c.NameLabel = "logger"
+	}
+	if c.LevelLabel == "" {
+		c.LevelLabel = "level"
+	}
+
+	staticLabels := make([]string, 0, len(c.Labels))
+	for name := range c.Labels {
+		staticLabels = append(staticLabels, name)
+	}
+	sort.Strings(staticLabels)
+
+	ctxLabels := make(map[string]struct{}, len(c.CtxLabels))
+	for _, key := range c.CtxLabels {
+		ctxLabels[key] = struct{}{}
+	}
+
+	return EncoderFunc(out, func(out Writer, r Record) (err error) {
+		r.Depth++
+		if len(r.Ctxs)%2 != 0 {
+			return ErrKeyValueNum
+		}
+
+		labels := getFieldList()
+		defer putFieldList(labels)
+
+		for _, name := range staticLabels {
+			labels.set(CollisionOverwrite, lokiLabelName(name), c.Labels[name])
+		}
+		if c.NameLabel != "-" {
+			labels.set(CollisionOverwrite, lokiLabelName(c.NameLabel), r.Name)
+		}
+		if c.LevelLabel != "-" {
+			labels.set(CollisionOverwrite, lokiLabelName(c.LevelLabel), r.Lvl.String())
+		}
+
+		// Move the contexts as the labels out of the fields.
+		if len(ctxLabels) > 0 {
+			var ctxs []interface{}
+			for i := 0; i < len(r.Ctxs); i += 2 {
+				if _, ok := r.Ctxs[i].(groupKey); ok {
+					if ctxs != nil {
+						ctxs = append(ctxs, r.Ctxs[i:]...)
+					}
+					break
+				}
+
+				key, ok := r.Ctxs[i].(string)
+				if _, isLabel := ctxLabels[key]; !ok || !isLabel {
+					if ctxs != nil {
+						ctxs = append(ctxs, r.Ctxs[i], r.Ctxs[i+1])
+					}
+					continue
+				}
+
+				var v interface{}
+				if v, err = MayBeValuer(r, r.Ctxs[i+1]); err != nil {
+					return
+				}
+				labels.set(CollisionOverwrite, lokiLabelName(key), json2.ToString(v))
+
+				if ctxs == nil {
+					ctxs = make([]interface{}, i, len(r.Ctxs)-2)
+					copy(ctxs, r.Ctxs[:i])
+				}
+			}
+			if ctxs != nil {
+				r.Ctxs = ctxs
+			}
+		}
+		if len(labels.fields) == 0 {
+			labels.set(CollisionOverwrite, "logger", r.Name)
+		}
+
+		fields := getFieldList()
+		defer putFieldList(fields)
+
+		fields.set(CollisionOverwrite, "msg", r.Msg)
+		if err = collectFields(r, fields, CollisionOverwrite, ""); err != nil {
+			return
+		}
+
+		line := DefaultBufferPool.Get()
+		defer DefaultBufferPool.Put(line)
+		if c.JSONLine {
+			err = writeJSONObject(line, fields)
+		} else {
+			writeLogfmtFields(line, "", fields)
+		}
+		if err != nil {
+			return
+		}
+
+		w := DefaultBufferPool.Get()
+		defer DefaultBufferPool.Put(w)
+
+		w.WriteString(`{"stream":`)
+		if err = writeJSONObject(w, labels); err != nil {
+			return
+		}
+		w.WriteString(`,"values":[["`)
+		w.WriteString(strconv.FormatInt(r.now().UnixNano(), 10))
+		w.WriteString(`",`)
+		writeJSONString(w, line.String())
+		w.WriteString("]]}\n")
+
+		_, err = MayWriteLevel(out, r.Lvl, w.Bytes())
+		return
+	})
+}
+
+// lokiLabelName returns the label name, any character of which is not allowed
+// by Loki, that's, [a-zA-Z_][a-zA-Z0-9_]*, is replaced with '_'.
+func lokiLabelName(name string) string {
+	if name == "" {
+		return "_"
+	}
+
+	buf := []byte(name)
+	for i, c := range buf {
+		if !(c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+			(i > 0 && c >= '0' && c <= '9')) {
+			buf[i] = '_'
+		}
+	}
+	return string(buf)
+}
+
+// LokiWriter returns a BatchWriter which pushes the batches of the records
+// encoded by NewLokiEncoder to the push API of Grafana Loki, such as
+// "http://localhost:3100/loki/api/v1/push".
+//
+// The entries of each batch are grouped by the streams, and sorted
+// by the timestamp in each stream, as Loki requires. See HTTPWriter about
+// the retries and the configuration. For the multi-tenant Loki, you can set
+// the header "X-Scope-OrgID" by conf.Header.
+//
+// The invalid line in the batch, which is not the stream of NewLokiEncoder,
+// is skipped and counted by Failed, and passed to conf.Batch.ErrorHandler.
+func LokiWriter(url string, conf ...HTTPWriterConfig) *BatchWriter {
+	var c HTTPWriterConfig
+	if len(conf) > 0 {
+		c = conf[0]
+	}
+	return newBatchWriter(newHTTPSender(url, c, "application/json"), lokiPushBody, c.Batch)
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values lokiEntries       `json:"values"`
+}
+
+// lokiEntries is the entries of a stream, each of which is the pair of
+// the timestamp in nanoseconds and the log line.
+type lokiEntries [][2]string
+
+func (es lokiEntries) Len() int      { return len(es) }
+func (es lokiEntries) Swap(i, j int) { es[i], es[j] = es[j], es[i] }
+func (es lokiEntries) Less(i, j int) bool {
+	// The timestamps are the non-negative integers without the leading zeros.
+	ti, tj := es[i][0], es[j][0]
+	return len(ti) < len(tj) || (len(ti) == len(tj) && ti < tj)
+}
+
+// lokiPushBody converts the batch of the streams, one per line, to the body
+// of the push request, which merges the same streams and sorts their entries.
+//
+// The invalid lines are skipped and passed to drop, unless none is valid.
+func lokiPushBody(batch []byte, drop func([]byte, error)) ([]byte, error) {
+	var invalids [][]byte
+	var errs []error
+	var streams []*lokiStream
+	indexes := make(map[string]*lokiStream, 8)
+	for _, line := range bytes.Split(batch, []byte{'\n'}) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		s := new(lokiStream)
+		if err := json.Unmarshal(line, s); err != nil {
+			invalids = append(invalids, line)
+			errs = append(errs, err)
+			continue
+		}
+
+		key, _ := json.Marshal(s.Stream) // The keys of the map are sorted.
+		if stream, ok := indexes[string(key)]; ok {
+			stream.Values = append(stream.Values, s.Values...)
+		} else {
+			indexes[string(key)] = s
+			streams = append(streams, s)
+		}
+	}
+
+	if len(streams) == 0 {
+		if len(errs) > 0 {
+			return nil, permanentError{errs[0]}
+		}
+		return nil, permanentError{errors.New("no loki stream in the batch")}
+	}
+	for i, line := range invalids {
+		drop(line, permanentError{errs[i]})
+	}
+
+	for _, s := range streams {
+		sort.Stable(s.Values)
+	}
+	return json.Marshal(map[string]interface{}{"streams": streams})
+}
+
+// permanentError is the error which should not be retried by BatchWriter.
+type permanentError struct {
+	error
+}
+
+func (e permanentError) Retryable() bool           { return false }
+func (e permanentError) RetryAfter() time.Duration { return 0 }
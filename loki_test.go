@@ -0,0 +1,119 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ExampleNewLokiEncoder() {
+	clock := ClockFunc(func() time.Time { return time.Unix(1558027752, 0) })
+	conf := LokiEncoderConfig{CtxLabels: []string{"env"}, Labels: map[string]string{"app": "demo"}}
+
+	log := LoggerWithClock(New(NewLokiEncoder(os.Stdout, conf)), clock).WithName("http")
+	log = log.WithCxt("env", "prod", "instance", 1)
+	log.Info("hello world", "key", "value")
+
+	// Output:
+	// {"stream":{"app":"demo","logger":"http","level":"INFO","env":"prod"},"values":[["1558027752000000000","msg=\"hello world\" instance=1 key=value"]]}
+}
+
+func TestLokiEncoderNoLabels(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	conf := LokiEncoderConfig{NameLabel: "-", LevelLabel: "-", CtxLabels: []string{"env"}}
+	log := New(NewLokiEncoder(buf, conf)).WithName("app")
+	log.Info("msg")
+	log.WithCxt("env", "prod").Info("msg")
+
+	if lines := strings.Split(buf.String(), "\n"); len(lines) != 3 ||
+		!strings.HasPrefix(lines[0], `{"stream":{"logger":"app"},`) ||
+		!strings.HasPrefix(lines[1], `{"stream":{"env":"prod"},`) {
+		t.Errorf("unexpected streams: %s", buf.String())
+	}
+}
+
+func TestLokiWriter(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" ||
+			r.Header.Get("X-Scope-OrgID") != "tenant" {
+			t.Errorf("unexpected request headers: %v", r.Header)
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	w := LokiWriter(server.URL, HTTPWriterConfig{
+		Header: http.Header{"X-Scope-OrgID": []string{"tenant"}},
+	})
+
+	// The time goes back, so the entries are out of order.
+	now := time.Unix(10, 0)
+	clock := ClockFunc(func() time.Time { now = now.Add(-time.Second); return now })
+	conf := LokiEncoderConfig{NameLabel: "-", CtxLabels: []string{"1invalid-key"}, JSONLine: true}
+	log := LoggerWithClock(New(NewLokiEncoder(w, conf)), clock)
+
+	log.Info("a")
+	log.Error("b")
+	log.Info("c")
+	log.WithCxt("1invalid-key", "v").Info("d")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"streams":[` +
+		`{"stream":{"level":"INFO"},"values":[["7000000000","{\"msg\":\"c\"}"],["9000000000","{\"msg\":\"a\"}"]]},` +
+		`{"stream":{"level":"ERROR"},"values":[["8000000000","{\"msg\":\"b\"}"]]},` +
+		`{"stream":{"_invalid_key":"v","level":"INFO"},"values":[["6000000000","{\"msg\":\"d\"}"]]}]}`
+	if body != expected {
+		t.Errorf("expect '%s', but got '%s'", expected, body)
+	}
+}
+
+func TestLokiWriterInvalidLine(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	var dropped string
+	w := LokiWriter(server.URL, HTTPWriterConfig{Batch: BatchWriterConfig{
+		ErrorHandler: func(record []byte, err error) { dropped = string(record) },
+	}})
+	w.Write([]byte(`{"stream":{"level":"INFO"},"values":[["1","a"]]}` + "\n"))
+	w.Write([]byte("invalid\n"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := `{"streams":[{"stream":{"level":"INFO"},"values":[["1","a"]]}]}`; body != expected {
+		t.Errorf("expect '%s', but got '%s'", expected, body)
+	}
+	if dropped != "invalid" || w.Failed() != 1 {
+		t.Errorf("unexpected dropped record '%s' and %d failed records", dropped, w.Failed())
+	}
+}
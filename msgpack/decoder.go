@@ -0,0 +1,457 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package msgpack provides the decoder to read the records back from the stream
+// produced by logger.NewMsgpackEncoder.
+//
+// The values of the fields are decoded as the types below:
+//
+//     nil                  nil
+//     bool                 bool
+//     int formats          int64 (and the positive fixint)
+//     uint formats         uint64
+//     float32              float32
+//     float64              float64
+//     str                  string
+//     bin                  []byte
+//     array                []interface{}
+//     map                  []Field, which keeps the order
+//     timestamp extension  time.Time
+//     MsgpackExtDuration   time.Duration
+//     MsgpackExtJSON       json.RawMessage
+//
+package msgpack
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/xgfone/logger"
+)
+
+// MaxRecordSize is the maximum size of the payload of a record.
+var MaxRecordSize = 64 * 1024 * 1024
+
+// MaxDepth is the maximum depth of the nested arrays and maps in a record.
+var MaxDepth = 10000
+
+// ErrInvalidFormat is returned when the data is not a valid record.
+var ErrInvalidFormat = errors.New("msgpack: invalid format")
+
+// ErrTooDeep is returned when the arrays and maps in a record are nested
+// deeper than MaxDepth.
+var ErrTooDeep = errors.New("msgpack: too deep nesting")
+
+// Field is a key-value pair of the record.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Caller is the caller information of the record.
+type Caller struct {
+	File string
+	Line int
+	Func string
+}
+
+// Record is a decoded log record.
+type Record struct {
+	Time   time.Time
+	Level  logger.Level
+	Name   string
+	Msg    string
+	Caller Caller
+	Fields []Field
+}
+
+// Decoder reads the records from the stream produced by
+// logger.NewMsgpackEncoder.
+type Decoder struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// NewDecoder returns a new decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Decode reads the next record.
+//
+// It returns io.EOF if there is no more record, or io.ErrUnexpectedEOF
+// if the stream ends in the middle of a record.
+func (d *Decoder) Decode() (r Record, err error) {
+	var header [4]byte
+	if _, err = io.ReadFull(d.r, header[:]); err != nil {
+		return
+	}
+
+	size := int(binary.BigEndian.Uint32(header[:]))
+	if size > MaxRecordSize {
+		return r, fmt.Errorf("msgpack: the record size %d is too large", size)
+	}
+
+	if cap(d.buf) < size {
+		d.buf = make([]byte, size)
+	}
+	d.buf = d.buf[:size]
+	if _, err = io.ReadFull(d.r, d.buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+
+	return Unmarshal(d.buf)
+}
+
+// Unmarshal decodes the payload of a record without the length prefix.
+func Unmarshal(data []byte) (r Record, err error) {
+	p := parser{data: data}
+	n, err := p.mapHeader()
+	if err != nil {
+		return
+	}
+
+	for i := 0; i < n; i++ {
+		var key string
+		if key, err = p.str(); err != nil {
+			return
+		}
+
+		var v interface{}
+		if v, err = p.value(); err != nil {
+			return
+		}
+
+		var ok bool
+		switch key {
+		case "t":
+			r.Time, ok = v.(time.Time)
+		case "l":
+			var lvl int64
+			lvl, ok = v.(int64)
+			r.Level = logger.Level(lvl)
+		case "n":
+			r.Name, ok = v.(string)
+		case "m":
+			r.Msg, ok = v.(string)
+		case "c":
+			var fields []Field
+			if fields, ok = v.([]Field); ok {
+				r.Caller, ok = toCaller(fields)
+			}
+		case "f":
+			r.Fields, ok = v.([]Field)
+		default:
+			ok = true
+		}
+
+		if !ok {
+			return r, ErrInvalidFormat
+		}
+	}
+
+	if p.pos != len(p.data) {
+		err = ErrInvalidFormat
+	}
+	return
+}
+
+func toCaller(fields []Field) (c Caller, ok bool) {
+	for _, f := range fields {
+		switch f.Key {
+		case "file":
+			c.File, ok = f.Value.(string)
+		case "line":
+			var line int64
+			line, ok = f.Value.(int64)
+			c.Line = int(line)
+		case "func":
+			c.Func, ok = f.Value.(string)
+		default:
+			ok = true
+		}
+
+		if !ok {
+			return
+		}
+	}
+	return c, true
+}
+
+type parser struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+func (p *parser) next(n int) ([]byte, error) {
+	if n < 0 || len(p.data)-p.pos < n {
+		return nil, ErrInvalidFormat
+	}
+	bs := p.data[p.pos : p.pos+n]
+	p.pos += n
+	return bs, nil
+}
+
+func (p *parser) byte() (byte, error) {
+	bs, err := p.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return bs[0], nil
+}
+
+func (p *parser) uint(size int) (uint64, error) {
+	bs, err := p.next(size)
+	if err != nil {
+		return 0, err
+	}
+
+	switch size {
+	case 1:
+		return uint64(bs[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(bs)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(bs)), nil
+	default:
+		return binary.BigEndian.Uint64(bs), nil
+	}
+}
+
+func (p *parser) mapHeader() (int, error) {
+	b, err := p.byte()
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case b&0xf0 == 0x80:
+		return int(b & 0x0f), nil
+	case b == 0xde:
+		n, err := p.uint(2)
+		return int(n), err
+	case b == 0xdf:
+		n, err := p.uint(4)
+		return int(n), err
+	}
+	return 0, ErrInvalidFormat
+}
+
+func (p *parser) str() (string, error) {
+	v, err := p.value()
+	if err != nil {
+		return "", err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", ErrInvalidFormat
+	}
+	return s, nil
+}
+
+func (p *parser) value() (v interface{}, err error) {
+	b, err := p.byte()
+	if err != nil {
+		return
+	}
+
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xf0 == 0x80:
+		p.pos--
+		return p.fields()
+	case b&0xf0 == 0x90:
+		return p.array(int(b & 0x0f))
+	case b&0xe0 == 0xa0:
+		return p.bytes(int(b&0x1f), true)
+	}
+
+	var n uint64
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return p.uint(1 << (b - 0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (b - 0xd0)
+		if n, err = p.uint(size); err != nil {
+			return
+		}
+		switch size {
+		case 1:
+			return int64(int8(n)), nil
+		case 2:
+			return int64(int16(n)), nil
+		case 4:
+			return int64(int32(n)), nil
+		default:
+			return int64(n), nil
+		}
+
+	case 0xca:
+		if n, err = p.uint(4); err != nil {
+			return
+		}
+		return math.Float32frombits(uint32(n)), nil
+	case 0xcb:
+		if n, err = p.uint(8); err != nil {
+			return
+		}
+		return math.Float64frombits(n), nil
+
+	case 0xd9, 0xda, 0xdb:
+		if n, err = p.uint(1 << (b - 0xd9)); err != nil {
+			return
+		}
+		return p.bytes(int(n), true)
+	case 0xc4, 0xc5, 0xc6:
+		if n, err = p.uint(1 << (b - 0xc4)); err != nil {
+			return
+		}
+		return p.bytes(int(n), false)
+
+	case 0xdc, 0xdd:
+		if n, err = p.uint(2 << (b - 0xdc)); err != nil {
+			return
+		}
+		return p.array(int(n))
+	case 0xde, 0xdf:
+		p.pos--
+		return p.fields()
+
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return p.ext(1 << (b - 0xd4))
+	case 0xc7, 0xc8, 0xc9:
+		if n, err = p.uint(1 << (b - 0xc7)); err != nil {
+			return
+		}
+		return p.ext(int(n))
+	}
+
+	return nil, ErrInvalidFormat
+}
+
+func (p *parser) bytes(n int, str bool) (interface{}, error) {
+	bs, err := p.next(n)
+	if err != nil {
+		return nil, err
+	} else if str {
+		return string(bs), nil
+	}
+	return append([]byte(nil), bs...), nil
+}
+
+// enter increases the depth before parsing the nested array or map,
+// and leave must be called after parsing it.
+func (p *parser) enter() error {
+	if p.depth++; p.depth > MaxDepth {
+		return ErrTooDeep
+	}
+	return nil
+}
+
+func (p *parser) leave() { p.depth-- }
+
+func (p *parser) array(n int) (interface{}, error) {
+	if n > len(p.data)-p.pos {
+		return nil, ErrInvalidFormat
+	} else if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	vs := make([]interface{}, n)
+	for i := range vs {
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		vs[i] = v
+	}
+	return vs, nil
+}
+
+func (p *parser) fields() (interface{}, error) {
+	n, err := p.mapHeader()
+	if err != nil {
+		return nil, err
+	} else if n > len(p.data)-p.pos {
+		return nil, ErrInvalidFormat
+	} else if err = p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	fields := make([]Field, n)
+	for i := range fields {
+		if fields[i].Key, err = p.str(); err != nil {
+			return nil, err
+		}
+		if fields[i].Value, err = p.value(); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+func (p *parser) ext(n int) (interface{}, error) {
+	typ, err := p.byte()
+	if err != nil {
+		return nil, err
+	}
+	bs, err := p.next(n)
+	if err != nil {
+		return nil, err
+	}
+
+	switch int8(typ) {
+	case logger.MsgpackExtTimestamp:
+		switch n {
+		case 4:
+			return time.Unix(int64(binary.BigEndian.Uint32(bs)), 0), nil
+		case 8:
+			v := binary.BigEndian.Uint64(bs)
+			return time.Unix(int64(v&(1<<34-1)), int64(v>>34)), nil
+		case 12:
+			nsec := binary.BigEndian.Uint32(bs[:4])
+			sec := binary.BigEndian.Uint64(bs[4:])
+			return time.Unix(int64(sec), int64(nsec)), nil
+		}
+	case logger.MsgpackExtDuration:
+		if n == 8 {
+			return time.Duration(binary.BigEndian.Uint64(bs)), nil
+		}
+	case logger.MsgpackExtJSON:
+		return json.RawMessage(append([]byte(nil), bs...)), nil
+	}
+	return nil, ErrInvalidFormat
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package msgpack
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xgfone/logger"
+)
+
+func TestDecoder(t *testing.T) {
+	now := time.Date(2019, 5, 16, 17, 29, 12, 123456789, time.UTC)
+	clock := logger.ClockFunc(func() time.Time { return now })
+
+	buf := bytes.NewBuffer(nil)
+	log := logger.LoggerWithClock(logger.New(logger.NewMsgpackEncoder(buf)), clock).WithName("app")
+	log.Warn("first", "int", -1000, "uint", uint8(1), "float32", float32(1.5),
+		"float64", 2.5, "bool", true, "nil", nil, "bytes", []byte("abc"),
+		"time", now, "duration", time.Second, "error", errors.New("error"),
+		"slice", []interface{}{1, "a"}, "struct", struct{ A int }{1},
+		"http", logger.Group{"method", "GET"}, "long", strings.Repeat("a", 300))
+	log.Info("second")
+
+	dec := NewDecoder(buf)
+	r, err := dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.Time.Equal(now) || r.Level != logger.LvlWarn || r.Name != "app" || r.Msg != "first" {
+		t.Errorf("unexpected record: %+v", r)
+	}
+	if r.Caller.Func != "github.com/xgfone/logger/msgpack.TestDecoder" || r.Caller.Line != 36 ||
+		!strings.HasSuffix(r.Caller.File, "decoder_test.go") {
+		t.Errorf("unexpected caller: %+v", r.Caller)
+	}
+
+	expected := []Field{
+		{"int", int64(-1000)},
+		{"uint", uint64(1)},
+		{"float32", float32(1.5)},
+		{"float64", 2.5},
+		{"bool", true},
+		{"nil", nil},
+		{"bytes", []byte("abc")},
+		{"time", time.Unix(0, now.UnixNano())},
+		{"duration", time.Second},
+		{"error", "error"},
+		{"slice", []interface{}{int64(1), "a"}},
+		{"struct", json.RawMessage(`{"A":1}`)},
+		{"http", []Field{{"method", "GET"}}},
+		{"long", strings.Repeat("a", 300)},
+	}
+	if !reflect.DeepEqual(r.Fields, expected) {
+		t.Errorf("expected %v, but got %v", expected, r.Fields)
+	}
+
+	if r, err = dec.Decode(); err != nil {
+		t.Fatal(err)
+	} else if r.Msg != "second" || r.Level != logger.LvlInfo || r.Fields != nil {
+		t.Errorf("unexpected record: %+v", r)
+	}
+
+	if _, err = dec.Decode(); err != io.EOF {
+		t.Errorf("expected io.EOF, but got %v", err)
+	}
+}
+
+func TestUnmarshalTooDeep(t *testing.T) {
+	// {"f": [[[...nil...]]]}, which is nested by the arrays of one element.
+	nested := func(depth int) []byte {
+		data := []byte{0x81, 0xa1, 'f'}
+		data = append(data, bytes.Repeat([]byte{0x91}, depth)...)
+		return append(data, 0xc0)
+	}
+
+	if _, err := Unmarshal(nested(MaxDepth)); err != ErrInvalidFormat {
+		t.Errorf("expected ErrInvalidFormat, but got %v", err)
+	}
+	if _, err := Unmarshal(nested(MaxDepth + 1)); err != ErrTooDeep {
+		t.Errorf("expected ErrTooDeep, but got %v", err)
+	}
+}
@@ -38,6 +38,18 @@ type NoErrorLogger interface {
 	WithCxt(ctxs ...interface{}) NoErrorLogger
 }
 
+// NoErrorGroupWither is the same as GroupWither, but for NoErrorLogger,
+// which has been implemented by the built-in NoErrorLogger.
+type NoErrorGroupWither interface {
+	WithGroup(name string) NoErrorLogger
+}
+
+// NoErrorClockWither is the same as ClockWither, but for NoErrorLogger,
+// which has been implemented by the built-in NoErrorLogger.
+type NoErrorClockWither interface {
+	WithClock(clock Clock) NoErrorLogger
+}
+
 type loggerWithoutError struct {
 	Logger
 }
@@ -88,6 +100,14 @@ func (l loggerWithoutError) WithCxt(ctxs ...interface{}) NoErrorLogger {
 	return newNoErrorLogger(l.Logger.WithCxt(ctxs...), false)
 }
 
+func (l loggerWithoutError) WithGroup(name string) NoErrorLogger {
+	return newNoErrorLogger(LoggerWithGroup(l.Logger, name), false)
+}
+
+func (l loggerWithoutError) WithClock(clock Clock) NoErrorLogger {
+	return newNoErrorLogger(LoggerWithClock(l.Logger, clock), false)
+}
+
 func (l loggerWithoutError) Trace(msg string, args ...interface{}) {
 	l.Logger.Trace(msg, args...)
 }
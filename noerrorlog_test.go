@@ -34,3 +34,27 @@ func TestNoErrorLogger(t *testing.T) {
 		t.Fail()
 	}
 }
+
+type customLogger struct {
+	Logger
+}
+
+func TestLoggerWithGroupAndClock(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	conf := JSONEncoderConfig{TimeKey: "-", LevelKey: "-"}
+	log := customLogger{New(NewStreamJSONEncoder(buf, conf))}
+
+	// The custom logger has not implemented GroupWither and ClockWither.
+	LoggerWithGroup(LoggerWithClock(log, DefaultClock), "http").Info("msg", "id", 1)
+	if s := buf.String(); s != `{"name":"root","msg":"msg","http":{"id":1}}`+"\n" {
+		t.Errorf("unexpected output: %s", s)
+	}
+
+	nlog := ToNoErrorLogger(New(NewStreamJSONEncoder(buf, conf)))
+	if _, ok := nlog.(NoErrorGroupWither); !ok {
+		t.Error("NoErrorLogger has not implemented NoErrorGroupWither")
+	}
+	if _, ok := nlog.(NoErrorClockWither); !ok {
+		t.Error("NoErrorLogger has not implemented NoErrorClockWither")
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parse
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/xgfone/logger"
+)
+
+// The placeholders whose values never contain the space.
+var noSpacePlaceholders = map[string]bool{
+	"level":         true,
+	"short_level":   true,
+	"line":          true,
+	"lineno":        true,
+	"funcname":      true,
+	"filename":      true,
+	"long_filename": true,
+	"package":       true,
+	"caller":        true,
+	"long_caller":   true,
+}
+
+type fmtParser struct {
+	re     *regexp.Regexp
+	keys   []string
+	layout string
+	loc    *time.Location
+}
+
+// NewFmtParser returns a new parser to parse the line produced by
+// NewFmtEncoder, which is driven by the same template and delimiters
+// as conf, for example,
+//
+//     conf := logger.FmtEncoderConfig{Tmpl: "{time} [{level}] {caller}: {msg}"}
+//     enc := logger.NewFmtEncoder(os.Stdout, conf)
+//     parser, err := parse.NewFmtParser(conf)
+//
+// The placeholder "time" or "utctime" is parsed to Time by conf.TimeLayout
+// and conf.TimeLocation, "level" or "short_level" to Level, "name" to Name,
+// "msg" to Msg, and the others to Fields, the values of which are strings.
+//
+// The contexts of the placeholder "ctx" joined by "|" are parsed as the
+// key-value pairs in turn, but "group.key=value" is parsed as a single pair.
+// If the key of the last pair is missing, it is "ctx".
+//
+// Notice: the template must separate the placeholders by the literal text,
+// and a placeholder whose value may contain the literal text after it
+// may be parsed incorrectly, except for the last one.
+func NewFmtParser(conf ...logger.FmtEncoderConfig) (Parser, error) {
+	var c logger.FmtEncoderConfig
+	if len(conf) > 0 {
+		c = conf[0]
+	}
+	if c.Tmpl = strings.TrimSpace(c.Tmpl); c.Tmpl == "" {
+		c.Tmpl = "{time} {ctx} {caller} [{level}]: {msg}"
+	}
+	if c.Left == "" {
+		c.Left = "{"
+	}
+	if c.Right == "" {
+		c.Right = "}"
+	}
+
+	p := &fmtParser{layout: c.TimeLayout, loc: time.Local}
+	if p.layout == "" {
+		p.layout = time.RFC3339Nano
+	}
+	if c.TimeLocation != "" {
+		loc, err := time.LoadLocation(c.TimeLocation)
+		if err != nil {
+			return nil, err
+		}
+		p.loc = loc
+	}
+
+	var pattern []string
+	pattern = append(pattern, "^")
+	for tmpl := c.Tmpl; ; {
+		i := strings.Index(tmpl, c.Left)
+		if i < 0 {
+			pattern = append(pattern, regexp.QuoteMeta(tmpl))
+			break
+		}
+		j := strings.Index(tmpl[i+len(c.Left):], c.Right)
+		if j < 0 {
+			pattern = append(pattern, regexp.QuoteMeta(tmpl))
+			break
+		}
+
+		var verb bool
+		key := tmpl[i+len(c.Left) : i+len(c.Left)+j]
+		if index := strings.IndexByte(key, ':'); index > -1 {
+			key, verb = key[:index], true // Remove the verb, such as "{level:-5s}".
+		}
+
+		pattern = append(pattern, regexp.QuoteMeta(tmpl[:i]))
+		switch {
+		case noSpacePlaceholders[key] && !verb:
+			pattern = append(pattern, `(\S*?)`)
+		default:
+			pattern = append(pattern, `(.*?)`)
+		}
+		p.keys = append(p.keys, key)
+		tmpl = tmpl[i+len(c.Left)+j+len(c.Right):]
+	}
+
+	// The last placeholder at the end consumes the rest of the line.
+	if len(pattern) > 2 && pattern[len(pattern)-1] == "" {
+		pattern[len(pattern)-2] = `(.*)`
+	}
+	pattern = append(pattern, "$")
+
+	re, err := regexp.Compile(strings.Join(pattern, ""))
+	if err != nil {
+		return nil, err
+	}
+	p.re = re
+	return p, nil
+}
+
+func (p *fmtParser) Parse(line string) (r Record, err error) {
+	matches := p.re.FindStringSubmatch(strings.TrimRight(line, "\r\n"))
+	if matches == nil {
+		return r, ErrNotMatch
+	}
+
+	for i, key := range p.keys {
+		value := matches[i+1]
+		switch key {
+		case "time":
+			r.Time, err = parseTime(value, p.layout, p.loc)
+		case "utctime":
+			r.Time, err = parseTime(value, p.layout, time.UTC)
+		case "level", "short_level":
+			if r.Level, r.HasLevel = NameToLevel(strings.TrimSpace(value)); !r.HasLevel {
+				err = fmt.Errorf("invalid level '%s'", value)
+			}
+		case "name":
+			r.Name = strings.TrimSpace(value)
+		case "msg":
+			r.Msg = value
+		case "ctx":
+			r.Fields = append(r.Fields, parseContexts(value)...)
+		default:
+			r.Fields = append(r.Fields, Field{Key: key, Value: value})
+		}
+
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// parseContexts parses the contexts formatted by the placeholder "ctx".
+func parseContexts(s string) (fields []Field) {
+	if s == "" {
+		return
+	}
+
+	var key string
+	var hasKey bool
+	for _, ctx := range strings.Split(s, "|") {
+		if index := strings.IndexByte(ctx, '='); index > 0 && !hasKey &&
+			strings.IndexByte(ctx[:index], '.') > 0 {
+			fields = append(fields, Field{Key: ctx[:index], Value: ctx[index+1:]})
+			continue
+		}
+
+		if hasKey {
+			fields = append(fields, Field{Key: key, Value: ctx})
+			hasKey = false
+		} else {
+			key, hasKey = ctx, true
+		}
+	}
+
+	if hasKey {
+		fields = append(fields, Field{Key: "ctx", Value: key})
+	}
+	return
+}
@@ -0,0 +1,338 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/xgfone/logger"
+)
+
+// kvParser parses the key-value lines, the reserved keys of which are
+// configured by logger.JSONEncoderConfig.
+type kvParser struct {
+	timeKey  string
+	levelKey string
+	nameKey  string
+	msgKey   string
+	layout   string
+	loc      *time.Location
+	kvSep    string
+	pairSep  string
+}
+
+func newKVParser(conf []logger.JSONEncoderConfig) *kvParser {
+	var c logger.JSONEncoderConfig
+	if len(conf) > 0 {
+		c = conf[0]
+	}
+
+	p := &kvParser{
+		timeKey:  c.TimeKey,
+		levelKey: c.LevelKey,
+		nameKey:  c.NameKey,
+		msgKey:   c.MsgKey,
+		layout:   c.TimeLayout,
+		loc:      time.Local,
+		kvSep:    c.TextKVSep,
+		pairSep:  c.TextKVPairSep,
+	}
+
+	if p.timeKey == "" {
+		p.timeKey = "time"
+	}
+	if p.levelKey == "" {
+		p.levelKey = "level"
+	}
+	if p.nameKey == "" {
+		p.nameKey = "name"
+	}
+	if p.msgKey == "" {
+		p.msgKey = "msg"
+	}
+	if p.layout == "" {
+		p.layout = time.RFC3339Nano
+	}
+	if p.kvSep == "" {
+		p.kvSep = "="
+	}
+	if p.pairSep == "" {
+		p.pairSep = " "
+	}
+
+	if p.timeKey == "utctime" {
+		p.loc = time.UTC
+	}
+	if c.TimeLocation != "" {
+		loc, err := time.LoadLocation(c.TimeLocation)
+		if err != nil {
+			panic(err)
+		}
+		p.loc = loc
+	}
+	return p
+}
+
+// setField sets the reserved field into the record, or appends it into
+// the fields. It reports whether the field is the message.
+func (p *kvParser) setField(r *Record, key string, value interface{}) (msg bool, err error) {
+	switch key {
+	case p.timeKey:
+		r.Time, err = p.parseTime(value)
+	case p.levelKey:
+		name, _ := value.(string)
+		if r.Level, r.HasLevel = NameToLevel(name); !r.HasLevel {
+			err = fmt.Errorf("invalid level '%v'", value)
+		}
+	case p.nameKey:
+		r.Name = toString(value)
+	case p.msgKey:
+		r.Msg = toString(value)
+		msg = true
+	default:
+		r.Fields = append(r.Fields, Field{Key: key, Value: value})
+	}
+	return
+}
+
+func (p *kvParser) parseTime(v interface{}) (time.Time, error) {
+	switch _v := v.(type) {
+	case string:
+		return parseTime(_v, p.layout, p.loc)
+	case json.Number:
+		switch p.layout {
+		case logger.TimeUnix, logger.TimeUnixMilli, logger.TimeUnixNano:
+			return parseUnixTime(_v.String(), p.layout)
+		}
+		if i, err := _v.Int64(); err == nil {
+			return guessUnixTime(i), nil
+		}
+		return parseUnixTime(_v.String(), logger.TimeUnix)
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%v'", v)
+}
+
+// NewJSONParser returns a new parser to parse the line produced by
+// NewStdJSONEncoder, NewSimpleJSONEncoder or NewStreamJSONEncoder.
+//
+// The reserved keys, the time layout and location are configured by conf
+// like the encoders, but NameKey is "name" by default. The order of the keys
+// is kept, and the nested objects are parsed to []Field.
+//
+// If the time is the number, its unit is decided by TimeLayout if it is
+// logger.TimeUnix, logger.TimeUnixMilli or logger.TimeUnixNano, or guessed
+// by the magnitude.
+func NewJSONParser(conf ...logger.JSONEncoderConfig) Parser {
+	p := newKVParser(conf)
+	return ParserFunc(func(line string) (r Record, err error) {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "{") {
+			return r, ErrNotMatch
+		}
+
+		dec := json.NewDecoder(strings.NewReader(line))
+		dec.UseNumber()
+
+		v, err := parseJSONValue(dec)
+		if err != nil {
+			return
+		} else if _, err = dec.Token(); err != io.EOF {
+			return r, fmt.Errorf("unexpected data after the JSON object in '%s'", line)
+		}
+		err = nil
+
+		fields, ok := v.([]Field)
+		if !ok {
+			return r, ErrNotMatch
+		}
+
+		var msg, isMsg bool
+		for _, f := range fields {
+			if isMsg, err = p.setField(&r, f.Key, f.Value); err != nil {
+				return
+			}
+			msg = msg || isMsg
+		}
+
+		if !msg {
+			err = ErrNotMatch
+		}
+		return
+	})
+}
+
+func parseJSONValue(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		fields := []Field{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := parseJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, Field{Key: key.(string), Value: value})
+		}
+		_, err = dec.Token()
+		return fields, err
+
+	case json.Delim('['):
+		values := []interface{}{}
+		for dec.More() {
+			value, err := parseJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		_, err = dec.Token()
+		return values, err
+	}
+
+	return token, nil
+}
+
+// NewTextParser returns a new parser to parse the line produced by
+// NewTextJSONEncoder, such as
+//
+//     time=2019-05-16T17:29:12Z level=INFO key=value msg=the message
+//
+// The reserved keys, the separators, the time layout and location are
+// configured by conf like the encoder, but NameKey is "name" by default.
+//
+// Because the values are not quoted, a value extends to the next pair
+// separator followed by a key and the key-value separator, and the message
+// is always the rest of the line. The dotted keys of the nested objects
+// are kept as they are, and all the values are strings.
+func NewTextParser(conf ...logger.JSONEncoderConfig) Parser {
+	p := newKVParser(conf)
+	return ParserFunc(func(line string) (r Record, err error) {
+		line = strings.TrimRight(line, "\r\n")
+
+		var msg bool
+		for line != "" {
+			index := strings.Index(line, p.kvSep)
+			if index < 1 || strings.Contains(line[:index], p.pairSep) {
+				return r, ErrNotMatch
+			}
+
+			key := line[:index]
+			line = line[index+len(p.kvSep):]
+			if key == p.msgKey {
+				_, err = p.setField(&r, key, line)
+				msg = true
+				break
+			}
+
+			end := p.nextKey(line)
+			if _, err = p.setField(&r, key, line[:end]); err != nil {
+				return
+			}
+			if line = line[end:]; line != "" {
+				line = line[len(p.pairSep):]
+			}
+		}
+
+		if !msg {
+			err = ErrNotMatch
+		}
+		return
+	})
+}
+
+// nextKey returns the index of the pair separator before the next key.
+func (p *kvParser) nextKey(s string) int {
+	for i := 0; i < len(s); {
+		index := strings.Index(s[i:], p.pairSep)
+		if index < 0 {
+			break
+		}
+
+		start := i + index
+		rest := s[start+len(p.pairSep):]
+		if k := strings.Index(rest, p.kvSep); k > 0 && !strings.Contains(rest[:k], p.pairSep) {
+			return start
+		}
+		i = start + len(p.pairSep)
+	}
+	return len(s)
+}
+
+func toString(v interface{}) string {
+	switch _v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return _v
+	case json.Number:
+		return _v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// AppendJSON appends the JSON of the value parsed by the parsers into buf,
+// and []Field is output as the object in order.
+func AppendJSON(buf []byte, v interface{}) []byte {
+	switch _v := v.(type) {
+	case []Field:
+		buf = append(buf, '{')
+		for i, f := range _v {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendJSONString(buf, f.Key)
+			buf = append(buf, ':')
+			buf = AppendJSON(buf, f.Value)
+		}
+		return append(buf, '}')
+	case []interface{}:
+		buf = append(buf, '[')
+		for i, e := range _v {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = AppendJSON(buf, e)
+		}
+		return append(buf, ']')
+	case json.Number:
+		return append(buf, _v...)
+	case string:
+		return appendJSONString(buf, _v)
+	default:
+		bs, err := json.Marshal(v)
+		if err != nil {
+			return appendJSONString(buf, err.Error())
+		}
+		return append(buf, bs...)
+	}
+}
+
+func appendJSONString(buf []byte, s string) []byte {
+	bs, _ := json.Marshal(s)
+	return append(buf, bs...)
+}
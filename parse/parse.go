@@ -0,0 +1,279 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package parse reads the lines produced by the encoders back into
+// the structured records, and converts them between the formats.
+//
+// It supports the lines produced by NewStdJSONEncoder, NewSimpleJSONEncoder,
+// NewStreamJSONEncoder, NewTextJSONEncoder and NewFmtEncoder. For example,
+// convert the text logs to JSON:
+//
+//     p := parse.NewTextParser()
+//     enc := logger.NewStdJSONEncoder(os.Stdout, logger.JSONEncoderConfig{NameKey: "name"})
+//     err := parse.Convert(os.Stdin, p, enc)
+//
+package parse
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/xgfone/logger"
+)
+
+// ErrNotMatch is returned when the line does not match the format.
+var ErrNotMatch = errors.New("the line does not match the format")
+
+// Field is a key-value pair of the record.
+//
+// The value parsed from JSON is one of nil, bool, json.Number, string,
+// []interface{} and []Field representing a nested object, and that parsed
+// from the text is always string.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Record is a parsed log record.
+type Record struct {
+	Time   time.Time
+	Level  logger.Level
+	Name   string
+	Msg    string
+	Fields []Field
+
+	// HasLevel reports whether the line contains the level.
+	HasLevel bool
+}
+
+// Lookup returns the value of the field by the key, which may be the dotted
+// path of the nested object, such as "http.method".
+func (r Record) Lookup(key string) (interface{}, bool) {
+	return lookupField(r.Fields, key)
+}
+
+func lookupField(fields []Field, key string) (interface{}, bool) {
+	for _, f := range fields {
+		if f.Key == key {
+			return f.Value, true
+		}
+	}
+
+	for _, f := range fields {
+		if sub, ok := f.Value.([]Field); ok && strings.HasPrefix(key, f.Key+".") {
+			if v, ok := lookupField(sub, key[len(f.Key)+1:]); ok {
+				return v, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Encode encodes the record by the encoder, which converts the record
+// to the format of the encoder.
+//
+// The fields are passed as the contexts, and the nested objects are converted
+// to logger.Group.
+//
+// If the line has no level, the level is rendered as "UNKNOWN". If it has no
+// time, the zero Time is passed, which the encoder fills with the current
+// time by default, so the encoder should override the valuer "time" to keep
+// it empty, for example,
+//
+//     logger.NewConsoleEncoder(w, logger.ConsoleEncoderConfig{
+//         Valuers: map[string]logger.Valuer{"time": parse.TimeValuer("15:04:05.000")},
+//     })
+//
+// Notice: because NewFmtEncoder formats the message by fmt.Sprintf,
+// the character '%' in the message will be handled as the verb.
+func (r Record) Encode(enc logger.Encoder) error {
+	lvl := r.Level
+	if !r.HasLevel {
+		lvl = unknownLevel
+	}
+
+	return enc.Encode(logger.Record{
+		Name: r.Name,
+		Msg:  r.Msg,
+		Lvl:  lvl,
+		Time: r.Time,
+		Ctxs: toKVs(r.Fields),
+	})
+}
+
+// unknownLevel is the level of the record without the level, which is out of
+// the predefined levels, so it is rendered as "UNKNOWN".
+const unknownLevel = logger.Level(-1)
+
+// TimeValuer returns a valuer which formats the time of the record encoded
+// by Record.Encode with the Go time layout, or returns the spaces as wide as
+// the formatted time if the record has no time.
+func TimeValuer(layout string) logger.Valuer {
+	blank := strings.Repeat(" ", len(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC).Format(layout)))
+	return func(r logger.Record) (interface{}, error) {
+		if r.Time.IsZero() {
+			return blank, nil
+		}
+		return r.Time.Local().Format(layout), nil
+	}
+}
+
+func toKVs(fields []Field) []interface{} {
+	kvs := make([]interface{}, 0, len(fields)*2)
+	for _, f := range fields {
+		if sub, ok := f.Value.([]Field); ok {
+			kvs = append(kvs, f.Key, logger.Group(toKVs(sub)))
+		} else {
+			kvs = append(kvs, f.Key, f.Value)
+		}
+	}
+	return kvs
+}
+
+// Parser is used to parse a line to the record.
+type Parser interface {
+	Parse(line string) (Record, error)
+}
+
+type parserFunc func(line string) (Record, error)
+
+func (f parserFunc) Parse(line string) (Record, error) {
+	return f(line)
+}
+
+// ParserFunc converts a function to Parser.
+func ParserFunc(f func(line string) (Record, error)) Parser {
+	return parserFunc(f)
+}
+
+// MultiParser returns a parser which tries the parsers in turn,
+// and returns the result of the first successful one.
+//
+// If all fail, return the error of the last one.
+func MultiParser(parsers ...Parser) Parser {
+	return ParserFunc(func(line string) (r Record, err error) {
+		err = ErrNotMatch
+		for _, p := range parsers {
+			if r, err = p.Parse(line); err == nil {
+				return
+			}
+		}
+		return
+	})
+}
+
+// Convert reads the lines from r, parses them by p, and encodes them by enc.
+//
+// The empty lines are skipped. If failing to parse a line, it returns
+// the error with the line number.
+func Convert(r io.Reader, p Parser, enc logger.Encoder) error {
+	reader := bufio.NewReader(r)
+	for lineno := 1; ; lineno++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		if line = strings.TrimRight(line, "\r\n"); line == "" {
+			continue
+		}
+
+		record, err := p.Parse(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", lineno, err)
+		}
+		if err = record.Encode(enc); err != nil {
+			return fmt.Errorf("line %d: %s", lineno, err)
+		}
+	}
+}
+
+// NameToLevel is the same as logger.NameToLevel, but reports whether
+// the name is valid instead of panicking.
+func NameToLevel(name string) (lvl logger.Level, ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	return logger.NameToLevel(name), true
+}
+
+// parseTime parses the time string by the layout, which may be
+// logger.TimeUnix, logger.TimeUnixMilli or logger.TimeUnixNano.
+func parseTime(s, layout string, loc *time.Location) (time.Time, error) {
+	switch layout {
+	case logger.TimeUnix, logger.TimeUnixMilli, logger.TimeUnixNano:
+		return parseUnixTime(s, layout)
+	}
+	return time.ParseInLocation(layout, s, loc)
+}
+
+func parseUnixTime(s, layout string) (time.Time, error) {
+	var i, frac int64
+	var n int
+	for ; n < len(s) && s[n] >= '0' && s[n] <= '9'; n++ {
+		i = i*10 + int64(s[n]-'0')
+	}
+	if n == 0 {
+		return time.Time{}, fmt.Errorf("invalid unix time '%s'", s)
+	}
+
+	// Only TimeUnix may have the fraction, such as the timestamp of GELF.
+	if n < len(s) {
+		if s[n] != '.' || layout != logger.TimeUnix {
+			return time.Time{}, fmt.Errorf("invalid unix time '%s'", s)
+		}
+		scale := int64(1e9)
+		for n++; n < len(s); n++ {
+			if s[n] < '0' || s[n] > '9' {
+				return time.Time{}, fmt.Errorf("invalid unix time '%s'", s)
+			}
+			if scale /= 10; scale > 0 {
+				frac += int64(s[n]-'0') * scale
+			}
+		}
+	}
+
+	switch layout {
+	case logger.TimeUnixMilli:
+		return time.Unix(0, i*int64(time.Millisecond)), nil
+	case logger.TimeUnixNano:
+		return time.Unix(0, i), nil
+	default:
+		return time.Unix(i, frac), nil
+	}
+}
+
+// guessUnixTime returns the time of the integer, the unit of which is guessed
+// by the magnitude.
+func guessUnixTime(i int64) time.Time {
+	switch {
+	case i > 1e17:
+		return time.Unix(0, i)
+	case i > 1e14:
+		return time.Unix(0, i*int64(time.Microsecond))
+	case i > 1e11:
+		return time.Unix(0, i*int64(time.Millisecond))
+	default:
+		return time.Unix(i, 0)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parse
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xgfone/logger"
+)
+
+var testClock = logger.ClockFunc(func() time.Time {
+	return time.Date(2019, 5, 16, 17, 29, 12, 123000000, time.UTC)
+})
+
+func ExampleConvert() {
+	text := "time=2019-05-16T17:29:12Z level=ERROR name=http http.status=500 msg=request failed\n" +
+		"time=2019-05-16T17:29:13Z level=INFO name=db msg=connected\n"
+
+	conf := logger.JSONEncoderConfig{NameKey: "name", TimeLocation: "UTC"}
+	enc := logger.NewStreamJSONEncoder(os.Stdout, conf)
+	if err := Convert(strings.NewReader(text), NewTextParser(), enc); err != nil {
+		panic(err)
+	}
+
+	// Output:
+	// {"time":"2019-05-16T17:29:12Z","level":"ERROR","name":"http","msg":"request failed","http.status":"500"}
+	// {"time":"2019-05-16T17:29:13Z","level":"INFO","name":"db","msg":"connected"}
+}
+
+func TestJSONParser(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	conf := logger.JSONEncoderConfig{NameKey: "name"}
+	log := logger.New(logger.MultiEncoder(
+		logger.NewStdJSONEncoder(buf, conf),
+		logger.NewSimpleJSONEncoder(buf, conf),
+		logger.NewStreamJSONEncoder(buf, conf),
+	))
+	log = logger.LoggerWithClock(log, testClock).WithName("app")
+	log.Warn("msg", "key", 123, "http", logger.Group{"method", "GET"})
+
+	p := NewJSONParser(conf)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, but got %d", len(lines))
+	}
+
+	for _, line := range lines {
+		r, err := p.Parse(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !r.Time.Equal(testClock.Now()) || r.Level != logger.LvlWarn ||
+			r.Name != "app" || r.Msg != "msg" {
+			t.Errorf("unexpected record: %+v", r)
+		}
+		if v, _ := r.Lookup("key"); v != json.Number("123") {
+			t.Errorf("unexpected key: %v", v)
+		}
+		if v, _ := r.Lookup("http.method"); v != "GET" {
+			t.Errorf("unexpected http.method: %v", v)
+		}
+	}
+
+	if _, err := p.Parse("not json"); err != ErrNotMatch {
+		t.Errorf("expected ErrNotMatch, but got %v", err)
+	}
+	for _, line := range []string{`{"msg":"a"} garbage`, `{"msg":"a"}{"msg":"b"}`} {
+		if _, err := p.Parse(line); err == nil || err == ErrNotMatch {
+			t.Errorf("%s: expect an error, but got %v", line, err)
+		}
+	}
+}
+
+func TestTextParser(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	conf := logger.JSONEncoderConfig{NameKey: "name", TimeLayout: logger.TimeUnixMilli}
+	log := logger.LoggerWithClock(logger.New(logger.NewTextJSONEncoder(buf, conf)), testClock).WithName("app")
+	log.Info("hello world", "path", "/a b", "http", logger.Group{"method", "GET"})
+
+	r, err := NewTextParser(conf).Parse(buf.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Record{
+		Time:     time.Unix(0, testClock.Now().UnixNano()),
+		Level:    logger.LvlInfo,
+		HasLevel: true,
+		Name:     "app",
+		Msg:      "hello world",
+		Fields:   []Field{{"path", "/a b"}, {"http.method", "GET"}},
+	}
+	if !reflect.DeepEqual(r, expected) {
+		t.Errorf("expected %+v, but got %+v", expected, r)
+	}
+}
+
+func TestFmtParser(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	conf := logger.FmtEncoderConfig{TimeLocation: "UTC"}
+	log := logger.LoggerWithClock(logger.New(logger.NewFmtEncoder(buf, conf)), testClock)
+	log = logger.LoggerWithGroup(log.WithCxt("id", 1), "req").WithCxt("method", "GET")
+	log.Error("%d%% failed", 50)
+
+	p, err := NewFmtParser(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := p.Parse(buf.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.Time.Equal(testClock.Now()) || r.Level != logger.LvlError || r.Msg != "50% failed" {
+		t.Errorf("unexpected record: %+v", r)
+	}
+	expected := []Field{{"id", "1"}, {"req.method", "GET"}, {"caller", "parse_test.go:122"}}
+	if !reflect.DeepEqual(r.Fields, expected) {
+		t.Errorf("expected %+v, but got %+v", expected, r.Fields)
+	}
+
+	conf = logger.FmtEncoderConfig{Tmpl: "[{level:-5s}] {name} - {msg}"}
+	if p, err = NewFmtParser(conf); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = p.Parse("[WARN ] app - a - b"); err != nil {
+		t.Fatal(err)
+	} else if r.Level != logger.LvlWarn || r.Name != "app" || r.Msg != "a - b" {
+		t.Errorf("unexpected record: %+v", r)
+	}
+}
+
+func TestRecordEncodeWithoutTimeAndLevel(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	enc := logger.NewConsoleEncoder(buf, logger.ConsoleEncoderConfig{
+		Color:    logger.ColorNever,
+		NoCaller: true,
+		Valuers:  map[string]logger.Valuer{"time": TimeValuer("15:04:05")},
+	})
+
+	r, err := NewTextParser().Parse("name=app msg=test")
+	if err != nil {
+		t.Fatal(err)
+	} else if err = r.Encode(enc); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "         UNKNOWN app        test\n"
+	if buf.String() != expected {
+		t.Errorf("expected '%s', but got '%s'", expected, buf.String())
+	}
+}
+
+func TestAppendJSON(t *testing.T) {
+	v := []Field{{"a", "x\"y"}, {"b", []interface{}{json.Number("1"), nil}}, {"c", []Field{{"d", true}}}}
+	if s := string(AppendJSON(nil, v)); s != `{"a":"x\"y","b":[1,null],"c":{"d":true}}` {
+		t.Errorf("unexpected JSON: %s", s)
+	}
+}
+
+func TestNameToLevel(t *testing.T) {
+	if lvl, ok := NameToLevel("warn"); !ok || lvl != logger.LvlWarn {
+		t.Errorf("unexpected level %v", lvl)
+	}
+	if _, ok := NameToLevel("invalid"); ok {
+		t.Error("expect an invalid level")
+	}
+}
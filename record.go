@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-stack/stack"
 )
@@ -33,6 +34,10 @@ type Record struct {
 	// Lvl is the level of the emitted log.
 	Lvl Level
 
+	// Time is the time when the log is emitted, which is captured only once
+	// by the Clock of the logger. So all the encoders use the same time.
+	Time time.Time
+
 	// Msg and Args are the arguments of the emitted log.
 	Msg  string
 	Args []interface{}
@@ -47,6 +52,14 @@ type Record struct {
 	okCall bool
 }
 
+// now returns the time of the record, or the current time if it's zero.
+func (r *Record) now() time.Time {
+	if r.Time.IsZero() {
+		return time.Now()
+	}
+	return r.Time
+}
+
 func (r *Record) getCaller() {
 	if !r.okCall {
 		r.caller = stack.Caller(r.Depth + 2)
@@ -33,16 +33,16 @@ func (s syslogWriter) Write(p []byte) (int, error) {
 
 func (s syslogWriter) WriteLevel(level Level, p []byte) (n int, err error) {
 	v := string(bytes.TrimSpace(p))
-	switch level {
-	case LvlFatal:
+	switch syslog.Priority(level.SyslogSeverity()) {
+	case syslog.LOG_EMERG:
 		err = s.w.Emerg(v)
-	case LvlPanic:
+	case syslog.LOG_CRIT:
 		err = s.w.Crit(v)
-	case LvlError:
+	case syslog.LOG_ERR:
 		err = s.w.Err(v)
-	case LvlWarn:
+	case syslog.LOG_WARNING:
 		err = s.w.Warning(v)
-	case LvlInfo:
+	case syslog.LOG_INFO:
 		err = s.w.Info(v)
 	default:
 		err = s.w.Debug(v)
@@ -56,6 +56,9 @@ func (s syslogWriter) WriteLevel(level Level, p []byte) (n int, err error) {
 
 // SyslogWriter opens a connection to the system syslog daemon
 // by calling syslog.New and writes all logs to it.
+//
+// Notice: it uses the legacy format of RFC 3164. For RFC 5424,
+// please use NewSyslogEncoder with SyslogRFC5424Writer.
 func SyslogWriter(priority syslog.Priority, tag string) (Writer, io.Closer, error) {
 	w, err := syslog.New(priority, tag)
 	if err != nil {
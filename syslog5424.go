@@ -0,0 +1,431 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xgfone/go-tools/json2"
+)
+
+// SyslogFacility is the facility of syslog.
+type SyslogFacility int
+
+// Predefine some syslog facilities.
+const (
+	FacilityKern SyslogFacility = iota
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLpr
+	FacilityNews
+	FacilityUucp
+	FacilityCron
+	FacilityAuthpriv
+	FacilityFtp
+	_
+	_
+	_
+	_
+	FacilityLocal0
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+// SyslogEncoderConfig is used to configure the RFC 5424 syslog encoder.
+type SyslogEncoderConfig struct {
+	// The facility of the message, which is FacilityUser by default.
+	//
+	// Notice: because FacilityKern is the zero value, it cannot be used.
+	Facility SyslogFacility
+
+	// The header fields HOSTNAME, APP-NAME, PROCID and MSGID.
+	//
+	// The default are os.Hostname(), the base name of os.Args[0], os.Getpid()
+	// and "-". The characters out of the printable US-ASCII are replaced
+	// with '_', and the fields are truncated to the lengths limited by RFC 5424.
+	Hostname string
+	AppName  string
+	ProcID   string
+	MsgID    string
+
+	// The SD-ID of the STRUCTURED-DATA element that the fields from
+	// the contexts and the arguments are put into, which is "fields@32473"
+	// by default.
+	StructuredDataID string
+
+	// Severity maps the level to the severity of syslog,
+	// which is Level.SyslogSeverity by default.
+	Severity func(Level) int
+}
+
+func (c *SyslogEncoderConfig) init() {
+	if c.Facility == FacilityKern {
+		c.Facility = FacilityUser
+	}
+	if c.Hostname == "" {
+		c.Hostname, _ = os.Hostname()
+	}
+	if c.AppName == "" && len(os.Args) > 0 {
+		c.AppName = filepath.Base(os.Args[0])
+	}
+	if c.ProcID == "" {
+		c.ProcID = strconv.Itoa(os.Getpid())
+	}
+	if c.StructuredDataID == "" {
+		c.StructuredDataID = "fields@32473"
+	}
+	if c.Severity == nil {
+		c.Severity = Level.SyslogSeverity
+	}
+
+	c.Hostname = syslogHeaderField(c.Hostname, 255)
+	c.AppName = syslogHeaderField(c.AppName, 48)
+	c.ProcID = syslogHeaderField(c.ProcID, 128)
+	c.MsgID = syslogHeaderField(c.MsgID, 32)
+	c.StructuredDataID = syslogSDName(c.StructuredDataID)
+}
+
+// NewSyslogEncoder returns a new encoder based on RFC 5424,
+// which outputs the log as follow:
+//
+//     <14>1 2019-05-16T17:29:12.000000Z host app 1234 - [fields@32473 key="value"] msg
+//
+// The fields from the contexts and the arguments are put into
+// the STRUCTURED-DATA element named conf.StructuredDataID. But each group
+// at the top level is output as a separate element, the SD-ID of which is
+// the group name with the same "@enterprise" suffix of conf.StructuredDataID,
+// or "@32473" if it has no suffix, and the keys of the nested groups in it
+// are joined by ".".
+//
+// It does not append a newline, so it should be used with SyslogRFC5424Writer.
+//
+// Notice: This encoder supports LevelWriter.
+func NewSyslogEncoder(out Writer, conf ...SyslogEncoderConfig) Encoder {
+	var c SyslogEncoderConfig
+	if len(conf) > 0 {
+		c = conf[0]
+	}
+	c.init()
+
+	suffix := "@32473"
+	if index := strings.IndexByte(c.StructuredDataID, '@'); index > -1 {
+		suffix = c.StructuredDataID[index:]
+	}
+
+	return EncoderFunc(out, func(out Writer, r Record) (err error) {
+		r.Depth++
+		fields := getFieldList()
+		defer putFieldList(fields)
+		if err = collectFields(r, fields, CollisionOverwrite, ""); err != nil {
+			return
+		}
+
+		w := DefaultBufferPool.Get()
+		defer DefaultBufferPool.Put(w)
+
+		var scratch [64]byte
+		w.WriteByte('<')
+		pri := int64(c.Facility)*8 + int64(c.Severity(r.Lvl))
+		w.Write(strconv.AppendInt(scratch[:0], pri, 10))
+		w.WriteString(">1 ")
+		w.Write(r.now().AppendFormat(scratch[:0], "2006-01-02T15:04:05.000000Z07:00"))
+		w.WriteByte(' ')
+		w.WriteString(c.Hostname)
+		w.WriteByte(' ')
+		w.WriteString(c.AppName)
+		w.WriteByte(' ')
+		w.WriteString(c.ProcID)
+		w.WriteByte(' ')
+		w.WriteString(c.MsgID)
+		w.WriteByte(' ')
+		writeSyslogStructuredData(w, c.StructuredDataID, suffix, fields)
+		if r.Msg != "" {
+			w.WriteByte(' ')
+			w.WriteString(r.Msg)
+		}
+
+		_, err = MayWriteLevel(out, r.Lvl, w.Bytes())
+		return
+	})
+}
+
+func writeSyslogStructuredData(w *bytes.Buffer, id, suffix string, l *fieldList) {
+	start := w.Len()
+
+	var hasParams bool
+	for _, f := range l.fields {
+		if _, ok := f.Value.(*fieldList); !ok {
+			hasParams = true
+			break
+		}
+	}
+	if hasParams {
+		w.WriteByte('[')
+		w.WriteString(id)
+		writeSyslogParams(w, "", l, true)
+		w.WriteByte(']')
+	}
+
+	for _, f := range l.fields {
+		if sub, ok := f.Value.(*fieldList); ok {
+			w.WriteByte('[')
+			w.WriteString(syslogSDID(f.Key, suffix))
+			writeSyslogParams(w, "", sub, false)
+			w.WriteByte(']')
+		}
+	}
+
+	if w.Len() == start {
+		w.WriteByte('-')
+	}
+}
+
+// writeSyslogParams writes the SD-PARAMs. If skipGroups is true, the nested
+// groups are ignored, or they are flattened with the prefix.
+func writeSyslogParams(w *bytes.Buffer, prefix string, l *fieldList, skipGroups bool) {
+	for _, f := range l.fields {
+		if sub, ok := f.Value.(*fieldList); ok {
+			if !skipGroups {
+				writeSyslogParams(w, prefix+f.Key+".", sub, false)
+			}
+			continue
+		}
+
+		w.WriteByte(' ')
+		w.WriteString(syslogSDName(prefix + f.Key))
+		w.WriteString(`="`)
+
+		var value string
+		switch v := f.Value.(type) {
+		case string:
+			value = v
+		case time.Time:
+			value = v.Format(time.RFC3339Nano)
+		default:
+			value = json2.ToString(v)
+		}
+
+		for i := 0; i < len(value); i++ {
+			switch c := value[i]; c {
+			case '"', '\\', ']':
+				w.WriteByte('\\')
+				w.WriteByte(c)
+			default:
+				w.WriteByte(c)
+			}
+		}
+		w.WriteByte('"')
+	}
+}
+
+// syslogHeaderField returns the header field, the characters of which out of
+// the printable US-ASCII are replaced with '_', and which is truncated to max.
+// If s is empty, return "-".
+func syslogHeaderField(s string, max int) string {
+	if s == "" {
+		return "-"
+	}
+	if len(s) > max {
+		s = s[:max]
+	}
+
+	bs := []byte(s)
+	for i, c := range bs {
+		if c < 33 || c > 126 {
+			bs[i] = '_'
+		}
+	}
+	return string(bs)
+}
+
+// syslogSDID returns the SD-ID of the group named name with the suffix
+// "@enterprise", the name of which is truncated to keep the suffix,
+// and whose '@' is replaced with '_'.
+func syslogSDID(name, suffix string) string {
+	name = strings.Replace(syslogSDName(name), "@", "_", -1)
+	if max := 32 - len(suffix); len(name) > max {
+		name = name[:max]
+	}
+	return name + suffix
+}
+
+// syslogSDName returns the SD-NAME, the invalid characters of which,
+// that's, '=', ' ', ']', '"' and those out of the printable US-ASCII,
+// are replaced with '_', and which is truncated to 32 characters.
+func syslogSDName(s string) string {
+	s = syslogHeaderField(s, 32)
+	if strings.IndexAny(s, `="]`) < 0 {
+		return s
+	}
+
+	bs := []byte(s)
+	for i, c := range bs {
+		if c == '=' || c == '"' || c == ']' {
+			bs[i] = '_'
+		}
+	}
+	return string(bs)
+}
+
+// ErrSyslogWriterClosed is returned when writing the log into the closed
+// RFC 5424 syslog writer.
+var ErrSyslogWriterClosed = errors.New("the syslog writer has been closed")
+
+// SyslogWriterConfig is used to configure the RFC 5424 syslog writer.
+type SyslogWriterConfig struct {
+	// The TLS configuration used by the network "tls".
+	TLSConfig *tls.Config
+
+	// The timeout to connect to the syslog server, which is 10s by default.
+	DialTimeout time.Duration
+}
+
+// SyslogRFC5424Writer opens a connection to the syslog server, and writes
+// the syslog messages over the connection, which are generated by
+// NewSyslogEncoder.
+//
+// The network may be "udp", "unixgram", "tcp", "tls" or "unix". For "udp"
+// and "unixgram", every message is sent as a datagram. For "tcp", "tls"
+// (RFC 5425) and "unix", the message is framed by the octet counting
+// of RFC 6587, that's, "MSG-LEN SP SYSLOG-MSG".
+//
+// If failing to write the message, it will reconnect to the server and write
+// it again once.
+//
+// It is thread-safe for concurrent writes.
+func SyslogRFC5424Writer(network, addr string, conf ...SyslogWriterConfig) (Writer, io.Closer, error) {
+	var c SyslogWriterConfig
+	if len(conf) > 0 {
+		c = conf[0]
+	}
+	if c.DialTimeout <= 0 {
+		c.DialTimeout = time.Second * 10
+	}
+
+	w := &syslog5424Writer{network: network, addr: addr, conf: c}
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+	case "tcp", "tcp4", "tcp6", "tls", "unix":
+		w.stream = true
+	default:
+		return nil, nil, fmt.Errorf("the syslog writer does not support the network '%s'", network)
+	}
+
+	if err := w.connect(); err != nil {
+		return nil, nil, err
+	}
+	return w, w, nil
+}
+
+type syslog5424Writer struct {
+	sync.Mutex
+	network string
+	addr    string
+	conf    SyslogWriterConfig
+	stream  bool
+	conn    net.Conn
+	closed  bool
+	buf     bytes.Buffer
+}
+
+func (w *syslog5424Writer) connect() error {
+	dialer := &net.Dialer{Timeout: w.conf.DialTimeout}
+	if w.network == "tls" {
+		conn, err := tls.DialWithDialer(dialer, "tcp", w.addr, w.conf.TLSConfig)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+		return nil
+	}
+
+	conn, err := dialer.Dial(w.network, w.addr)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+func (w *syslog5424Writer) Write(p []byte) (n int, err error) {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.closed {
+		return 0, ErrSyslogWriterClosed
+	}
+
+	msg := bytes.TrimRight(p, "\r\n")
+	data := msg
+	if w.stream {
+		var scratch [20]byte
+		w.buf.Reset()
+		w.buf.Write(strconv.AppendInt(scratch[:0], int64(len(msg)), 10))
+		w.buf.WriteByte(' ')
+		w.buf.Write(msg)
+		data = w.buf.Bytes()
+	}
+
+	if w.conn != nil {
+		if _, err = w.conn.Write(data); err == nil {
+			return len(p), nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+
+	if err = w.connect(); err != nil {
+		return
+	}
+	if _, err = w.conn.Write(data); err != nil {
+		w.conn.Close()
+		w.conn = nil
+		return
+	}
+	return len(p), nil
+}
+
+func (w *syslog5424Writer) Close() (err error) {
+	w.Lock()
+	defer w.Unlock()
+
+	if !w.closed {
+		w.closed = true
+		if w.conn != nil {
+			err = w.conn.Close()
+			w.conn = nil
+		}
+	}
+	return
+}
@@ -0,0 +1,135 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ExampleNewSyslogEncoder() {
+	clock := ClockFunc(func() time.Time { return time.Date(2019, 5, 16, 17, 29, 12, 0, time.UTC) })
+	conf := SyslogEncoderConfig{
+		Facility: FacilityLocal0,
+		Hostname: "host",
+		AppName:  "app",
+		ProcID:   "1234",
+		MsgID:    "ID47",
+	}
+
+	log := LoggerWithClock(New(NewSyslogEncoder(os.Stdout, conf)), clock)
+	log.Info("hello", "key", `a "quoted" value]`, "http", Group{"method", "GET", "req", Group{"id", 1}})
+	log.Error("no fields")
+
+	// Output:
+	// <134>1 2019-05-16T17:29:12.000000Z host app 1234 ID47 [fields@32473 key="a \"quoted\" value\]"][http@32473 method="GET" req.id="1"] hello<131>1 2019-05-16T17:29:12.000000Z host app 1234 ID47 - no fields
+}
+
+func TestSyslogSDID(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	conf := SyslogEncoderConfig{StructuredDataID: "fields", Hostname: "host", ProcID: "1"}
+	log := New(NewSyslogEncoder(buf, conf))
+	log.Info("msg", "a@b", Group{"k", 1}, strings.Repeat("g", 40), Group{"k", 2})
+
+	long := strings.Repeat("g", 26) + "@32473"
+	expected := `[a_b@32473 k="1"][` + long + ` k="2"]`
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("expected '%s' in '%s'", expected, buf.String())
+	}
+}
+
+func TestSyslogRFC5424WriterTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	w, c, err := SyslogRFC5424Writer("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	msgs := []string{"<14>1 - - - - - msg1", "<14>1 - - - - - multi\nline"}
+	for _, msg := range msgs {
+		if _, err = w.Write([]byte(msg + "\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := bufio.NewReader(conn)
+	for _, msg := range msgs {
+		size, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(size))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf := make([]byte, n)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			t.Fatal(err)
+		} else if string(buf) != msg {
+			t.Errorf("expected '%s', but got '%s'", msg, buf)
+		}
+	}
+}
+
+func TestSyslogRFC5424WriterUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w, c, err := SyslogRFC5424Writer("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := "<14>1 - - - - - msg"
+	w.Write([]byte(msg))
+	c.Close()
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(buf[:n]) != msg {
+		t.Errorf("expected '%s', but got '%s'", msg, buf[:n])
+	}
+
+	if _, err = w.Write([]byte(msg)); err != ErrSyslogWriterClosed {
+		t.Errorf("expected ErrSyslogWriterClosed, but got %v", err)
+	}
+}
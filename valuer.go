@@ -31,8 +31,8 @@ var Valuers = map[string]Valuer{
 	"name":          func(r Record) (interface{}, error) { return r.Name, nil },
 	"level":         func(r Record) (interface{}, error) { return r.Lvl.String(), nil },
 	"short_level":   func(r Record) (interface{}, error) { return r.Lvl.ShortString(), nil },
-	"time":          func(r Record) (interface{}, error) { return time.Now().Format(time.RFC3339Nano), nil },
-	"utctime":       func(r Record) (interface{}, error) { return time.Now().UTC().Format(time.RFC3339Nano), nil },
+	"time":          func(r Record) (interface{}, error) { return r.now().Format(time.RFC3339Nano), nil },
+	"utctime":       func(r Record) (interface{}, error) { return r.now().UTC().Format(time.RFC3339Nano), nil },
 	"line":          func(r Record) (interface{}, error) { r.Depth++; return r.Line(), nil },
 	"lineno":        func(r Record) (interface{}, error) { r.Depth++; return r.LineAsInt(), nil },
 	"funcname":      func(r Record) (interface{}, error) { r.Depth++; return r.FuncName(), nil },
@@ -43,6 +43,69 @@ var Valuers = map[string]Valuer{
 	"long_caller":   func(r Record) (interface{}, error) { r.Depth++; return r.LongCaller(), nil },
 }
 
+// Predefine some time layouts used by TimeValuer.
+//
+// TimeUnix, TimeUnixMilli and TimeUnixNano output the time as the integer,
+// and others output the time as the string with the fixed precision.
+const (
+	TimeUnix      = "unix"
+	TimeUnixMilli = "unixmilli"
+	TimeUnixNano  = "unixnano"
+
+	TimeISO8601      = "2006-01-02T15:04:05Z07:00"
+	TimeISO8601Milli = "2006-01-02T15:04:05.000Z07:00"
+	TimeISO8601Micro = "2006-01-02T15:04:05.000000Z07:00"
+	TimeISO8601Nano  = "2006-01-02T15:04:05.000000000Z07:00"
+)
+
+// TimeValuer returns a Valuer that returns the time of the record formatted
+// by layout in the location loc.
+//
+// layout may be any Go time layout, or TimeUnix, TimeUnixMilli or TimeUnixNano.
+// If it is empty, it is time.RFC3339Nano by default. If loc is nil,
+// it is time.Local by default.
+func TimeValuer(layout string, loc *time.Location) Valuer {
+	if layout == "" {
+		layout = time.RFC3339Nano
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+
+	return func(r Record) (interface{}, error) {
+		return formatTime(r.now(), layout, loc), nil
+	}
+}
+
+func formatTime(t time.Time, layout string, loc *time.Location) interface{} {
+	switch layout {
+	case TimeUnix:
+		return t.Unix()
+	case TimeUnixMilli:
+		return t.UnixNano() / int64(time.Millisecond)
+	case TimeUnixNano:
+		return t.UnixNano()
+	default:
+		return t.In(loc).Format(layout)
+	}
+}
+
+// loadTimeLocation returns the location by the name, such as "UTC", "Local"
+// or "Asia/Shanghai". If name is empty, return def.
+//
+// It panics if the location does not exist.
+func loadTimeLocation(name string, def *time.Location) *time.Location {
+	if name == "" {
+		return def
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(fmt.Errorf("invalid time location '%s': %s", name, err))
+	}
+	return loc
+}
+
 // A Valuer generates a log value, which represents a dynamic value
 // that is re-evaluated with each log event before firing it.
 type Valuer func(Record) (interface{}, error)
@@ -64,6 +127,9 @@ func MayBeValuer(record Record, v interface{}) (interface{}, error) {
 // Caller returns a Valuer that returns the caller "file:line".
 //
 // If fullPath is true, the file is the full path but removing the GOPATH prefix.
+//
+// If the caller of the record has been captured, for example, by AsyncEncoder,
+// it is used instead of the current stack.
 func Caller(fullPath ...bool) Valuer {
 	format := "%v"
 	if len(fullPath) > 0 && fullPath[0] {
@@ -71,6 +137,9 @@ func Caller(fullPath ...bool) Valuer {
 	}
 
 	return func(r Record) (interface{}, error) {
+		if r.okCall {
+			return fmt.Sprintf(format, r.caller), nil
+		}
 		return fmt.Sprintf(format, stack.Caller(r.Depth+1)), nil
 	}
 }
@@ -0,0 +1,57 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestFormatTime(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	now := time.Date(2019, 5, 16, 17, 29, 12, 120000000, time.UTC)
+	values := []struct {
+		layout string
+		result interface{}
+	}{
+		{TimeUnix, int64(1558027752)},
+		{TimeUnixMilli, int64(1558027752120)},
+		{TimeUnixNano, int64(1558027752120000000)},
+		{TimeISO8601Milli, "2019-05-17T01:29:12.120+08:00"},
+		{TimeISO8601Micro, "2019-05-17T01:29:12.120000+08:00"},
+		{"2006-01-02T15", "2019-05-17T01"},
+	}
+
+	for _, v := range values {
+		if result := formatTime(now, v.layout, loc); result != v.result {
+			t.Errorf("%s: expected %v, but got %v", v.layout, v.result, result)
+		}
+	}
+}
+
+func TestJSONEncoderTimeLayout(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	conf := JSONEncoderConfig{TimeLayout: TimeUnixMilli, LevelKey: "-"}
+	New(NewStreamJSONEncoder(buf, conf)).Info("msg")
+
+	var v struct{ Time int64 }
+	if err := json.Unmarshal(buf.Bytes(), &v); err != nil {
+		t.Error(err)
+	} else if now := time.Now().UnixNano() / 1e6; v.Time > now || v.Time < now-1000 {
+		t.Errorf("unexpected time %d", v.Time)
+	}
+}
@@ -20,7 +20,10 @@ import (
 	"io"
 	"net"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/xgfone/go-tools/function"
 )
@@ -105,6 +108,9 @@ func DiscardWriter() Writer {
 
 // NetWriter opens a socket to the given address and writes the log
 // over the connection.
+//
+// It dials only once, so all the writes fail after the connection drops.
+// For the long-running program, you can use ResilientNetWriter instead.
 func NetWriter(network, addr string) (Writer, io.Closer, error) {
 	conn, err := net.Dial(network, addr)
 	if err != nil {
@@ -119,23 +125,27 @@ func NetWriter(network, addr string) (Writer, io.Closer, error) {
 // If the path already exists, FileHook will append to the given file.
 // If it does not, FileHook will create the file with mode 0644,
 // but you can pass the second argument, mode, to modify it.
+//
+// The writer has also implemented the interfaces Flusher and Reopener.
+// It must be closed when no longer used, see ReopenFileWriters.
 func FileWriter(path string, mode ...os.FileMode) (Writer, io.Closer, error) {
 	var _mode os.FileMode = 0644
 	if len(mode) > 0 {
 		_mode = mode[0]
 	}
 
-	f, err := os.OpenFile(path, fileFlag, _mode)
+	f, err := newReopenFile(path, _mode)
 	if err != nil {
 		return nil, nil, err
 	}
-	return SafeWriter(f), f, nil
+	return f, f, nil
 }
 
 // ReopenWriter returns a writer that can be closed then re-opened,
 // which is used for logrotate typically.
 //
 // Notice: it used SafeWriter to wrap the writer, so it's thread-safe.
+// For the file reopened by the signal, you can use SignalReopenFileWriter.
 func ReopenWriter(factory func() (w io.WriteCloser, reopen <-chan bool, err error)) (Writer, error) {
 	w, reopen, err := factory()
 	if err != nil {
@@ -219,6 +229,8 @@ func SafeWriter(w Writer) Writer {
 //
 // It blocks if the channel is full. Useful for async processing
 // of log messages, it's used by BufferedWriter.
+//
+// Notice: it sends p itself to the channel, not the copy.
 func ChannelWriter(ch chan<- []byte) Writer {
 	return WriterFunc(func(p []byte) (int, error) {
 		ch <- p
@@ -231,6 +243,11 @@ func ChannelWriter(ch chan<- []byte) Writer {
 //
 // Since these writes happen asynchronously, all writes to a BufferedWriter
 // never return an error and any errors from the wrapped writer are ignored.
+//
+// The data are copied before being sent to the channel, because the encoders
+// reuse the buffer after writing. But the background goroutine cannot be
+// stopped, so you should use NewAsyncWriter instead, which supports
+// the overflow policies and draining the queue when closing.
 func BufferedWriter(bufSize int, w Writer) Writer {
 	ch := make(chan []byte, bufSize)
 	go func() {
@@ -238,7 +255,11 @@ func BufferedWriter(bufSize int, w Writer) Writer {
 			w.Write(bs)
 		}
 	}()
-	return ChannelWriter(ch)
+
+	out := ChannelWriter(ch)
+	return WriterFunc(func(p []byte) (int, error) {
+		return out.Write(append([]byte(nil), p...))
+	})
 }
 
 // SizedRotatingFileWriter returns a new file writer with rotating
@@ -248,8 +269,8 @@ func BufferedWriter(bufSize int, w Writer) Writer {
 //
 // The default permission of the log file is 0644.
 //
-// Notice: the file writer has also implemented the Flusher interface,
-// so you can do it as follow:
+// Notice: the file writer has also implemented the interfaces Flusher,
+// Rotator and Reopener, so you can do it as follow:
 //
 //     file, _ := SizedRotatingFileWriter("file.log", 1024*1024*1024, 30)
 //
@@ -259,24 +280,84 @@ func BufferedWriter(bufSize int, w Writer) Writer {
 //     // Synchronize the data to the underlying disk.
 //     file.(Flusher).Flush()
 //
+//     // Rotate the file on demand.
+//     file.(Rotator).Rotate()
+//
 func SizedRotatingFileWriter(filename string, size, count int,
 	mode ...os.FileMode) (Writer, io.Closer, error) {
 
-	var _mode os.FileMode = 0644
-	if len(mode) > 0 && mode[0] > 0 {
+	var _mode os.FileMode
+	if len(mode) > 0 {
 		_mode = mode[0]
 	}
 
+	return SizedRotatingFileWriterWithConfig(filename, SizedRotatingFileConfig{
+		MaxSize:     size,
+		BackupCount: count,
+		FileMode:    _mode,
+	})
+}
+
+// SizedRotatingFileConfig is used to configure the sized rotating file writer.
+type SizedRotatingFileConfig struct {
+	// The maximum size of the log file. If exceeding it, the file is rotated.
+	MaxSize int
+
+	// The number of the backups, such as "file.1", "file.2", etc.
+	// If it's 0, the file won't be rotated.
+	BackupCount int
+
+	// The permission of the log file, which is 0644 by default.
+	FileMode os.FileMode
+
+	// If not nil, the rotated backups are compressed by it in the background,
+	// such as "file.1.gz", "file.2.gz", etc.
+	Compressor FileCompressor
+
+	// If greater than 0, the backups modified before MaxAge ago are removed.
+	MaxAge time.Duration
+
+	// If greater than 0, the oldest backups are removed until the total size
+	// of the backups and the log file is not greater than MaxTotalSize.
+	MaxTotalSize int64
+}
+
+// SizedRotatingFileWriterWithConfig is the same as SizedRotatingFileWriter,
+// but configured by SizedRotatingFileConfig.
+//
+// If conf.Compressor is set, the backup "file.1" is compressed in a new
+// goroutine after rotating, and the compressed backups are shifted along
+// the backup chain like the uncompressed. The uncompressed backups left by
+// the last run are compressed when starting.
+//
+// The retention policies, conf.MaxAge and conf.MaxTotalSize, are applied to
+// all the backups like "file.N" and "file.N.EXT", no matter whether N is
+// greater than conf.BackupCount. They are applied when starting, and after
+// every rotation and the compression of the backup.
+//
+// Notice: if the file is rotated again before the last compression finishes,
+// the rotation will wait for it, during which the writes go on to the current
+// file. And Close also waits for the compression.
+func SizedRotatingFileWriterWithConfig(filename string, conf SizedRotatingFileConfig) (Writer, io.Closer, error) {
+	if conf.FileMode == 0 {
+		conf.FileMode = 0644
+	}
+
 	w := sizedRotatingFile{
 		filename:    filename,
-		filePerm:    _mode,
-		maxSize:     size,
-		backupCount: count,
+		filePerm:    conf.FileMode,
+		maxSize:     conf.MaxSize,
+		backupCount: conf.BackupCount,
+		compressor:  newBackupCompressor(conf.Compressor),
+		retention:   retention{MaxAge: conf.MaxAge, MaxTotalSize: conf.MaxTotalSize},
 	}
 
 	if err := w.open(); err != nil {
 		return nil, nil, err
 	}
+	w.removeBackups()
+	w.compressBackups()
+	registerFileWriter(&w)
 	return &w, &w, nil
 }
 
@@ -290,17 +371,28 @@ type sizedRotatingFile struct {
 	maxSize     int
 	backupCount int
 	nbytes      int
+	compressor  *backupCompressor
+	retention   retention
 }
 
 func (f *sizedRotatingFile) Close() (err error) {
+	unregisterFileWriter(f)
 	f.Lock()
-	err = f.close()
+	if f.file != nil {
+		err = f.close()
+	}
 	f.Unlock()
+	f.compressor.Wait()
 	return
 }
 
-func (f *sizedRotatingFile) Flush() error {
-	return f.file.Sync()
+func (f *sizedRotatingFile) Flush() (err error) {
+	f.Lock()
+	if f.file != nil {
+		err = f.file.Sync()
+	}
+	f.Unlock()
+	return
 }
 
 func (f *sizedRotatingFile) Write(data []byte) (n int, err error) {
@@ -308,13 +400,21 @@ func (f *sizedRotatingFile) Write(data []byte) (n int, err error) {
 	defer f.Unlock()
 
 	if f.file == nil {
-		return 0, errors.New("the file has been closed")
+		return 0, errFileClosed
 	}
 
-	if f.nbytes+len(data) > f.maxSize {
+	for f.nbytes+len(data) > f.maxSize {
+		if f.waitCompression() {
+			if f.file == nil {
+				return 0, errFileClosed
+			}
+			continue // Check it again, because it may have been rotated.
+		}
+
 		if err = f.doRollover(); err != nil {
 			return
 		}
+		break
 	}
 
 	if n, err = f.file.Write(data); err != nil {
@@ -325,6 +425,55 @@ func (f *sizedRotatingFile) Write(data []byte) (n int, err error) {
 	return
 }
 
+// Rotate rotates the file immediately, which does nothing if the number
+// of the backups is 0 or the file is empty.
+func (f *sizedRotatingFile) Rotate() error {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.file == nil {
+		return errFileClosed
+	}
+	for f.waitCompression() {
+		if f.file == nil {
+			return errFileClosed
+		}
+	}
+	return f.doRollover()
+}
+
+// waitCompression waits for the compression of the backup with the lock
+// released, because the backup being compressed must not be renamed,
+// and reports whether it has waited. The writes go on during the wait,
+// so the caller must check the state again if true.
+func (f *sizedRotatingFile) waitCompression() bool {
+	if f.backupCount == 0 || !f.compressor.Busy() {
+		return false
+	}
+
+	f.Unlock()
+	f.compressor.Wait()
+	f.Lock()
+	return true
+}
+
+// Reopen opens the file by the filename again, then closes the old one.
+// If failing to open it, the old one is still used.
+func (f *sizedRotatingFile) Reopen() (err error) {
+	f.Lock()
+	defer f.Unlock()
+
+	old := f.file
+	if old == nil {
+		return errFileClosed
+	}
+
+	if err = f.open(); err == nil {
+		old.Close()
+	}
+	return
+}
+
 func (f *sizedRotatingFile) open() (err error) {
 	file, err := os.OpenFile(f.filename, fileFlag, f.filePerm)
 	if err != nil {
@@ -333,6 +482,7 @@ func (f *sizedRotatingFile) open() (err error) {
 
 	info, err := file.Stat()
 	if err != nil {
+		file.Close()
 		return
 	}
 
@@ -347,46 +497,122 @@ func (f *sizedRotatingFile) close() (err error) {
 	return
 }
 
+func (f *sizedRotatingFile) backupName(i int) string {
+	return fmt.Sprintf("%s.%d", f.filename, i)
+}
+
+// compressBackups compresses the uncompressed backups, which may be left
+// because the program exited before compressing them.
+func (f *sizedRotatingFile) compressBackups() {
+	if f.compressor == nil {
+		return
+	}
+
+	ext := f.compressor.Ext()
+	for i := 1; i <= f.backupCount; i++ {
+		name := f.backupName(i)
+		os.Remove(name + ext + ".tmp")
+		if fileIsExist(name) {
+			if fileIsExist(name + ext) {
+				os.Remove(name + ext)
+			}
+			f.compressor.Compress(name, nil)
+		}
+	}
+}
+
+// removeBackups removes the backups by the retention policies.
+func (f *sizedRotatingFile) removeBackups() {
+	if f.retention.IsZero() {
+		return
+	}
+
+	// Sort the backups by the index, that's, from the newest to the oldest.
+	var max int
+	indexes := make(map[int][]string)
+	prefix := f.filename + "."
+	for _, name := range globFiles(globEscape(prefix) + "*") {
+		if suffix := name[len(prefix):]; isBackupSuffix(suffix) {
+			if index := strings.IndexByte(suffix, '.'); index > -1 {
+				suffix = suffix[:index]
+			}
+			if i, err := strconv.Atoi(suffix); err == nil {
+				indexes[i] = append(indexes[i], name)
+				if i > max {
+					max = i
+				}
+			}
+		}
+	}
+
+	backups := make([]string, 0, len(indexes))
+	for i := 0; i <= max; i++ {
+		backups = append(backups, indexes[i]...)
+	}
+	f.retention.Apply(backups, f.filename, time.Now())
+}
+
 func (f *sizedRotatingFile) doRollover() (err error) {
 	if f.backupCount > 0 {
+		// Reopen the current file if failing to rotate it,
+		// so that the writer goes on writing it.
+		defer func() {
+			if f.file == nil {
+				if e := f.open(); e != nil && err == nil {
+					err = e
+				}
+			}
+		}()
+
 		if err = f.close(); err != nil {
 			return fmt.Errorf("Rotating: close failed: %s", err)
 		}
 
-		if !fileIsExist(f.filename) {
-			return nil
-		} else if n, err := fileSize(f.filename); err != nil {
+		if n, err := fileSize(f.filename); err != nil && !os.IsNotExist(err) {
 			return fmt.Errorf("Rotating: failed to get the size: %s", err)
 		} else if n == 0 {
-			return nil
+			return f.open()
 		}
 
 		for _, i := range function.Range(f.backupCount-1, 0, -1) {
-			sfn := fmt.Sprintf("%s.%d", f.filename, i)
-			dfn := fmt.Sprintf("%s.%d", f.filename, i+1)
-			if fileIsExist(sfn) {
-				if fileIsExist(dfn) {
-					os.Remove(dfn)
-				}
-				if err = os.Rename(sfn, dfn); err != nil {
-					return fmt.Errorf("Rotating: failed to rename %s -> %s: %s",
-						sfn, dfn, err)
-				}
+			if err = f.renameBackup(f.backupName(i), f.backupName(i+1)); err != nil {
+				return
 			}
 		}
-		dfn := f.filename + ".1"
-		if fileIsExist(dfn) {
-			if err = os.Remove(dfn); err != nil {
-				return fmt.Errorf("Rotating: failed to remove %s: %s", dfn, err)
+		if err = f.renameBackup(f.filename, f.backupName(1)); err != nil {
+			return
+		}
+		if err = f.open(); err != nil {
+			return
+		}
+		f.compressor.Compress(f.backupName(1), f.removeBackups)
+	}
+	return
+}
+
+// renameBackup renames the backup sfn, compressed or not, to dfn,
+// which removes dfn at first.
+func (f *sizedRotatingFile) renameBackup(sfn, dfn string) (err error) {
+	exts := []string{""}
+	if ext := f.compressor.Ext(); ext != "" {
+		exts = append(exts, ext)
+	}
+
+	for _, ext := range exts {
+		if fileIsExist(dfn + ext) {
+			if err = os.Remove(dfn + ext); err != nil {
+				return fmt.Errorf("Rotating: failed to remove %s: %s", dfn+ext, err)
 			}
 		}
-		if fileIsExist(f.filename) {
-			if err = os.Rename(f.filename, dfn); err != nil {
+	}
+
+	for _, ext := range exts {
+		if fileIsExist(sfn + ext) {
+			if err = os.Rename(sfn+ext, dfn+ext); err != nil {
 				return fmt.Errorf("Rotating: failed to rename %s -> %s: %s",
-					f.filename, dfn, err)
+					sfn+ext, dfn+ext, err)
 			}
 		}
-		err = f.open()
 	}
 	return
 }
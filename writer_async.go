@@ -0,0 +1,416 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Some errors returned by AsyncWriter.
+var (
+	ErrAsyncWriterClosed  = errors.New("the async writer has been closed")
+	ErrAsyncWriterTimeout = errors.New("timeout to drain the async writer")
+)
+
+// OverflowPolicy is the policy of AsyncWriter when the queue is full.
+type OverflowPolicy int
+
+// Predefine some overflow policies.
+const (
+	// Block until the queue is not full.
+	OverflowBlock OverflowPolicy = iota
+
+	// Block until the queue is not full or the timeout, then drop the record.
+	OverflowBlockTimeout
+
+	// Drop the record being written.
+	OverflowDropNewest
+
+	// Drop the oldest record in the queue to make room for the new one.
+	OverflowDropOldest
+
+	// Keep one out of every SampleRate records, which blocks until
+	// the queue is not full, and drop the others.
+	OverflowSample
+)
+
+// AsyncWriterConfig is used to configure the async writer.
+type AsyncWriterConfig struct {
+	// The maximum number of the records in the queue, which is 1024 by default.
+	QueueSize int
+
+	// The policy when the queue is full, which is OverflowBlock by default.
+	Policy OverflowPolicy
+
+	// The timeout of OverflowBlockTimeout, which is 100ms by default.
+	BlockTimeout time.Duration
+
+	// The sample rate of OverflowSample, which is 10 by default.
+	SampleRate int
+
+	// The timeout for Flush and Close to wait for the queued records to be
+	// written, which is 10s by default.
+	DrainTimeout time.Duration
+}
+
+// AsyncWriter writes the records into the underlying writer
+// in a background goroutine.
+//
+// Unlike BufferedWriter, it copies the bytes before queuing them, so it's safe
+// to reuse the bytes after calling Write or WriteLevel, which the encoders do.
+type AsyncWriter struct {
+	dropped   uint64
+	failed    uint64
+	overflows uint64
+	closed    int32
+
+	w    Writer
+	conf AsyncWriterConfig
+
+	queue   chan asyncRecord
+	done    chan struct{}
+	exited  chan struct{}
+	counter *asyncCounter
+}
+
+type asyncRecord struct {
+	data     []byte
+	level    Level
+	hasLevel bool
+}
+
+// NewAsyncWriter returns a new AsyncWriter to write the records into w.
+//
+// If w is a LevelWriter, the records written by WriteLevel are written
+// into w by WriteLevel with the same level.
+//
+// It is thread-safe for concurrent writes.
+func NewAsyncWriter(w Writer, conf ...AsyncWriterConfig) *AsyncWriter {
+	var c AsyncWriterConfig
+	if len(conf) > 0 {
+		c = conf[0]
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = 1024
+	}
+	if c.BlockTimeout <= 0 {
+		c.BlockTimeout = time.Millisecond * 100
+	}
+	if c.SampleRate <= 0 {
+		c.SampleRate = 10
+	}
+	if c.DrainTimeout <= 0 {
+		c.DrainTimeout = time.Second * 10
+	}
+
+	a := &AsyncWriter{
+		w:       w,
+		conf:    c,
+		queue:   make(chan asyncRecord, c.QueueSize),
+		done:    make(chan struct{}),
+		exited:  make(chan struct{}),
+		counter: newAsyncCounter(),
+	}
+	go a.loop()
+	return a
+}
+
+// Dropped returns the number of the dropped records.
+func (a *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// Failed returns the number of the records which failed to be written
+// into the underlying writer.
+func (a *AsyncWriter) Failed() uint64 {
+	return atomic.LoadUint64(&a.failed)
+}
+
+// Queued returns the number of the records in the queue.
+func (a *AsyncWriter) Queued() int {
+	return len(a.queue)
+}
+
+// Write implements the interface Writer.
+//
+// It does not return the error even if the record is dropped,
+// except that the writer has been closed.
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	return a.write(asyncRecord{data: p})
+}
+
+// WriteLevel implements the interface LevelWriter.
+func (a *AsyncWriter) WriteLevel(level Level, p []byte) (int, error) {
+	return a.write(asyncRecord{data: p, level: level, hasLevel: true})
+}
+
+func (a *AsyncWriter) write(r asyncRecord) (int, error) {
+	if atomic.LoadInt32(&a.closed) != 0 {
+		return 0, ErrAsyncWriterClosed
+	}
+
+	n := len(r.data)
+	r.data = append([]byte(nil), r.data...)
+	if !a.enqueue(r) {
+		atomic.AddUint64(&a.dropped, 1)
+	}
+	return n, nil
+}
+
+// enqueue puts the record into the queue, and reports whether it succeeds.
+func (a *AsyncWriter) enqueue(r asyncRecord) bool {
+	put := func() bool {
+		select {
+		case a.queue <- r:
+			return true
+		default:
+			return false
+		}
+	}
+
+	if a.counter.Enqueue(put) {
+		return true
+	}
+
+	switch a.conf.Policy {
+	case OverflowDropNewest:
+		return false
+
+	case OverflowDropOldest:
+		for {
+			select {
+			case <-a.queue:
+				atomic.AddUint64(&a.dropped, 1)
+				a.counter.Done()
+			default:
+			}
+
+			if a.counter.Enqueue(put) {
+				return true
+			}
+		}
+
+	case OverflowBlockTimeout:
+		timer := time.NewTimer(a.conf.BlockTimeout)
+		defer timer.Stop()
+		return a.counter.EnqueueWait(put, a.done, timer.C)
+
+	case OverflowSample:
+		// Keep the first overflowing record, then every SampleRate-th one.
+		if (atomic.AddUint64(&a.overflows, 1)-1)%uint64(a.conf.SampleRate) != 0 {
+			return false
+		}
+		fallthrough
+
+	default:
+		return a.counter.EnqueueWait(put, a.done, nil)
+	}
+}
+
+func (a *AsyncWriter) loop() {
+	defer close(a.exited)
+	for {
+		select {
+		case r := <-a.queue:
+			var err error
+			if r.hasLevel {
+				_, err = MayWriteLevel(a.w, r.level, r.data)
+			} else {
+				_, err = a.w.Write(r.data)
+			}
+			if err != nil {
+				atomic.AddUint64(&a.failed, 1)
+			}
+			a.counter.Done()
+		case <-a.done:
+			return
+		}
+	}
+}
+
+// drain waits until all the records queued before calling it are written.
+func (a *AsyncWriter) drain(timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	if !a.counter.Wait(a.counter.Target(), timer.C) {
+		return ErrAsyncWriterTimeout
+	}
+	return nil
+}
+
+// Flush waits until all the records queued before calling it are written,
+// then flushes the underlying writer if it is a Flusher.
+//
+// It returns ErrAsyncWriterTimeout if the records are not written
+// in conf.DrainTimeout.
+func (a *AsyncWriter) Flush() error {
+	if err := a.drain(a.conf.DrainTimeout); err != nil {
+		return err
+	}
+	if f, ok := a.w.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Close stops receiving the new records, waits until the queued records
+// are written, then closes the underlying writer if it is an io.Closer.
+//
+// If the queued records are not written in conf.DrainTimeout, it returns
+// ErrAsyncWriterTimeout, the remaining records are dropped, and the underlying
+// writer won't be closed because it may be still being written.
+func (a *AsyncWriter) Close() (err error) {
+	if !atomic.CompareAndSwapInt32(&a.closed, 0, 1) {
+		return nil
+	}
+
+	err = a.drain(a.conf.DrainTimeout)
+	close(a.done)
+	if err != nil {
+		return
+	}
+
+	// Drop the records written concurrently while closing.
+	<-a.exited
+	for n := len(a.queue); n > 0; n-- {
+		select {
+		case <-a.queue:
+			atomic.AddUint64(&a.dropped, 1)
+		default:
+		}
+	}
+
+	if c, ok := a.w.(io.Closer); ok {
+		err = c.Close()
+	}
+	return
+}
+
+// asyncCounter counts the records put into the queue and those taken out of
+// it, which is used to wait for the records queued before a moment to be
+// processed.
+//
+// The records are counted only when being put into the queue with the lock
+// held, so the counts follow the FIFO order of the queue, and the records
+// dropped without being queued are never counted.
+type asyncCounter struct {
+	processed uint64
+	waiters   int32
+
+	lock     sync.Mutex
+	enqueued uint64
+	progress chan struct{}
+}
+
+func newAsyncCounter() *asyncCounter {
+	return &asyncCounter{progress: make(chan struct{})}
+}
+
+// Enqueue calls put, which puts a record into the queue without blocking
+// and reports whether it succeeds, then counts the record if true.
+func (c *asyncCounter) Enqueue(put func() bool) (ok bool) {
+	c.lock.Lock()
+	if ok = put(); ok {
+		c.enqueued++
+	}
+	c.lock.Unlock()
+	return
+}
+
+// EnqueueWait is the same as Enqueue, but tries again after a record is
+// taken out of the queue if it is full, until cancel is closed or timeout
+// fires. cancel and timeout may be nil.
+func (c *asyncCounter) EnqueueWait(put func() bool, cancel <-chan struct{},
+	timeout <-chan time.Time) bool {
+
+	if c.Enqueue(put) {
+		return true
+	}
+
+	atomic.AddInt32(&c.waiters, 1)
+	defer atomic.AddInt32(&c.waiters, -1)
+
+	for {
+		c.lock.Lock()
+		progress := c.progress
+		ok := put()
+		if ok {
+			c.enqueued++
+		}
+		c.lock.Unlock()
+
+		if ok {
+			return true
+		}
+
+		select {
+		case <-progress:
+		case <-cancel:
+			return false
+		case <-timeout:
+			return false
+		}
+	}
+}
+
+// Done marks a record taken out of the queue as processed, which is written
+// or dropped, and wakes up the goroutines waiting for the progress.
+func (c *asyncCounter) Done() {
+	atomic.AddUint64(&c.processed, 1)
+	if atomic.LoadInt32(&c.waiters) > 0 {
+		c.lock.Lock()
+		close(c.progress)
+		c.progress = make(chan struct{})
+		c.lock.Unlock()
+	}
+}
+
+// Target returns the number of the records queued until now.
+func (c *asyncCounter) Target() uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.enqueued
+}
+
+// Wait waits until target records have been processed, and returns false
+// if timeout fires before that.
+func (c *asyncCounter) Wait(target uint64, timeout <-chan time.Time) bool {
+	if atomic.LoadUint64(&c.processed) >= target {
+		return true
+	}
+
+	atomic.AddInt32(&c.waiters, 1)
+	defer atomic.AddInt32(&c.waiters, -1)
+
+	for {
+		c.lock.Lock()
+		progress := c.progress
+		c.lock.Unlock()
+
+		if atomic.LoadUint64(&c.processed) >= target {
+			return true
+		}
+
+		select {
+		case <-progress:
+		case <-timeout:
+			return false
+		}
+	}
+}
@@ -0,0 +1,458 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Some errors returned by BatchWriter.
+var (
+	ErrBatchWriterClosed  = errors.New("the batch writer has been closed")
+	ErrBatchWriterTimeout = errors.New("timeout to drain the batch writer")
+)
+
+// BatchWriterConfig is used to configure the batch writer.
+type BatchWriterConfig struct {
+	// A batch is cut when it has MaxRecords records, which is 100 by default.
+	MaxRecords int
+
+	// A batch is cut when it has MaxBytes bytes, which is 64KB by default.
+	// The batch never exceeds it unless a single record does.
+	MaxBytes int
+
+	// A batch is cut when MaxDelay has passed since its first record was
+	// written, which is 1s by default.
+	MaxDelay time.Duration
+
+	// The separator inserted between the records in a batch, which is empty
+	// by default, that's, the records are concatenated.
+	//
+	// Notice: the records produced by the builtin encoders have ended with
+	// the newline, so they are separated by lines already.
+	Separator []byte
+
+	// The number of the batches waiting to be written, which is 16
+	// by default. Write blocks while the queue is full, but the queue may
+	// exceed it by a few batches, because the batches are also cut by
+	// MaxDelay and Flush, and Write may cut two batches once, which never
+	// wait for the queue.
+	QueueSize int
+
+	// The maximum number of the retries when failing to write a batch,
+	// which is 3 by default. If it's negative, don't retry.
+	MaxRetries int
+
+	// The retry interval starts from RetryInterval, which is 100ms by default,
+	// and doubles after each retry, up to MaxRetryInterval, which is 10s
+	// by default. MaxRetryInterval also caps the interval of RetryAfter.
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+
+	// The timeout for Flush and Close to wait for the queued batches to be
+	// written, which is 10s by default.
+	DrainTimeout time.Duration
+
+	// If not nil, it is called with the batch and the last error
+	// when the batch is dropped after all the retries fail, or with
+	// ErrBatchWriterTimeout when it is dropped by Close.
+	//
+	// If each batch is prepared before being written, it is also called
+	// with each invalid record skipped from the batch, which is counted
+	// as failed.
+	ErrorHandler func(batch []byte, err error)
+}
+
+// BatchWriter accumulates the records and writes them into the underlying
+// writer as a single batch by one call of Write, for example, so that many
+// records are sent by NetWriter in one packet.
+//
+// A batch is cut when it reaches conf.MaxRecords or conf.MaxBytes,
+// or conf.MaxDelay has passed since its first record, whichever comes first.
+// Then it's written in a background goroutine, and retried with exponential
+// backoff if failing. If the error has the methods Retryable and RetryAfter,
+// such as HTTPError, the batch is not retried when Retryable returns false,
+// and the positive interval returned by RetryAfter is used instead, up to
+// conf.MaxRetryInterval. Close still waits for the intervals before
+// the retries, but no longer than conf.DrainTimeout.
+//
+// To hand the batches to a callback, you can use WriterFunc, such as
+//
+//     NewBatchWriter(WriterFunc(func(batch []byte) (int, error) {
+//         return len(batch), send(batch)
+//     }))
+//
+// Notice: the batch passed to the underlying writer must not be retained
+// after Write returns, because it may be retried.
+type BatchWriter struct {
+	failed uint64
+
+	w       Writer
+	conf    BatchWriterConfig
+	prepare batchPreparer
+
+	// The batches are queued into pending, and cond is signaled when
+	// a batch is queued or taken, or the writer is closed. So the lock is
+	// never held when waiting for the queue.
+	lock    sync.Mutex
+	cond    *sync.Cond
+	buf     []byte
+	count   int
+	gen     uint64
+	timer   *time.Timer
+	closed  bool
+	pending []batch
+
+	abort   chan struct{}
+	exited  chan struct{}
+	counter *asyncCounter
+}
+
+type batch struct {
+	data  []byte
+	count int
+}
+
+// batchPreparer converts the batch before it is written, such as to the body
+// of the request, which is called only once for each batch. It may skip
+// the invalid records in the batch, each of which is passed to drop.
+type batchPreparer func(batch []byte, drop func(record []byte, err error)) ([]byte, error)
+
+// NewBatchWriter returns a new BatchWriter to write the batches into w.
+//
+// It is thread-safe for concurrent writes.
+func NewBatchWriter(w Writer, conf ...BatchWriterConfig) *BatchWriter {
+	var c BatchWriterConfig
+	if len(conf) > 0 {
+		c = conf[0]
+	}
+	return newBatchWriter(w, nil, c)
+}
+
+func newBatchWriter(w Writer, prepare batchPreparer, c BatchWriterConfig) *BatchWriter {
+	if c.MaxRecords <= 0 {
+		c.MaxRecords = 100
+	}
+	if c.MaxBytes <= 0 {
+		c.MaxBytes = 64 * 1024
+	}
+	if c.MaxDelay <= 0 {
+		c.MaxDelay = time.Second
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = 16
+	}
+	if c.MaxRetries == 0 {
+		c.MaxRetries = 3
+	}
+	if c.RetryInterval <= 0 {
+		c.RetryInterval = time.Millisecond * 100
+	}
+	if c.MaxRetryInterval <= 0 {
+		c.MaxRetryInterval = time.Second * 10
+	}
+	if c.DrainTimeout <= 0 {
+		c.DrainTimeout = time.Second * 10
+	}
+
+	b := &BatchWriter{
+		w:       w,
+		conf:    c,
+		prepare: prepare,
+		pending: make([]batch, 0, c.QueueSize),
+		abort:   make(chan struct{}),
+		exited:  make(chan struct{}),
+		counter: newAsyncCounter(),
+	}
+	b.cond = sync.NewCond(&b.lock)
+	go b.loop()
+	return b
+}
+
+// Failed returns the number of the records dropped because the batches
+// containing them failed to be written after all the retries.
+func (b *BatchWriter) Failed() uint64 {
+	return atomic.LoadUint64(&b.failed)
+}
+
+// Queued returns the number of the batches waiting to be written.
+func (b *BatchWriter) Queued() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return len(b.pending)
+}
+
+// Write implements the interface Writer.
+//
+// p is copied into the current batch, so it's safe to reuse it after returning.
+func (b *BatchWriter) Write(p []byte) (n int, err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for !b.closed && len(b.pending) >= b.conf.QueueSize {
+		b.cond.Wait()
+	}
+	if b.closed {
+		return 0, ErrBatchWriterClosed
+	}
+
+	if b.count > 0 && len(b.buf)+len(b.conf.Separator)+len(p) > b.conf.MaxBytes {
+		b.cut()
+	}
+
+	if b.count == 0 {
+		gen := b.gen
+		b.timer = time.AfterFunc(b.conf.MaxDelay, func() { b.expire(gen) })
+	} else {
+		b.buf = append(b.buf, b.conf.Separator...)
+	}
+	b.buf = append(b.buf, p...)
+	b.count++
+
+	if b.count >= b.conf.MaxRecords || len(b.buf) >= b.conf.MaxBytes {
+		b.cut()
+	}
+	return len(p), nil
+}
+
+// expire cuts the batch whose generation is gen if it has not been cut.
+func (b *BatchWriter) expire(gen uint64) {
+	b.lock.Lock()
+	if !b.closed && b.gen == gen && b.count > 0 {
+		b.cut()
+	}
+	b.lock.Unlock()
+}
+
+// cut queues the current batch and starts a new one, which must be called
+// with the lock held. It never blocks, and Write waits for the full queue.
+func (b *BatchWriter) cut() {
+	if b.count == 0 {
+		return
+	}
+
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	b.counter.Enqueue(func() bool {
+		b.pending = append(b.pending, batch{data: b.buf, count: b.count})
+		return true
+	})
+	b.cond.Broadcast()
+
+	b.buf = make([]byte, 0, len(b.buf))
+	b.count = 0
+	b.gen++
+}
+
+// next takes the first queued batch, and returns false if the writer has
+// been closed and all the batches have been taken.
+func (b *BatchWriter) next() (_ batch, ok bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for len(b.pending) == 0 {
+		if b.closed {
+			return
+		}
+		b.cond.Wait()
+	}
+
+	first := b.pending[0]
+	copy(b.pending, b.pending[1:])
+	b.pending[len(b.pending)-1] = batch{}
+	b.pending = b.pending[:len(b.pending)-1]
+	b.cond.Broadcast()
+	return first, true
+}
+
+func (b *BatchWriter) loop() {
+	defer close(b.exited)
+	for {
+		batch, ok := b.next()
+		if !ok {
+			return
+		}
+
+		var err error
+		data := batch.data
+		if b.prepare != nil {
+			data, err = b.prepare(data, b.drop)
+		}
+		if err == nil {
+			err = b.send(data)
+		}
+		if err != nil {
+			atomic.AddUint64(&b.failed, uint64(batch.count))
+			if b.conf.ErrorHandler != nil {
+				b.conf.ErrorHandler(batch.data, err)
+			}
+		}
+		b.counter.Done()
+	}
+}
+
+// drop counts the record skipped by b.prepare, and calls the error handler.
+func (b *BatchWriter) drop(record []byte, err error) {
+	atomic.AddUint64(&b.failed, 1)
+	if b.conf.ErrorHandler != nil {
+		b.conf.ErrorHandler(record, err)
+	}
+}
+
+// retryableError is the error returned by the underlying writer of BatchWriter
+// to control the retry, such as HTTPError.
+type retryableError interface {
+	error
+
+	// Retryable reports whether the batch should be retried.
+	Retryable() bool
+
+	// RetryAfter returns the interval before the retry,
+	// which overrides the backoff interval if positive.
+	RetryAfter() time.Duration
+}
+
+// send writes the batch into the underlying writer, and retries
+// with exponential backoff if failing.
+func (b *BatchWriter) send(data []byte) (err error) {
+	for attempt := 0; ; attempt++ {
+		if _, err = b.w.Write(data); err == nil || attempt >= b.conf.MaxRetries {
+			return
+		}
+
+		if e, ok := err.(retryableError); ok && !e.Retryable() {
+			return
+		}
+
+		delay := backoff(b.conf.RetryInterval, b.conf.MaxRetryInterval, attempt)
+		if e, ok := err.(retryableError); ok {
+			if d := e.RetryAfter(); d > 0 {
+				delay = d
+			}
+		}
+		if delay > b.conf.MaxRetryInterval {
+			delay = b.conf.MaxRetryInterval
+		}
+
+		if !b.sleep(delay) {
+			return
+		}
+	}
+}
+
+// sleep waits for the delay before the retry, and returns false
+// if the writer has been aborted by Close.
+func (b *BatchWriter) sleep(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-b.abort:
+		return false
+	}
+}
+
+// backoff returns the delay before the attempt-th retry starting from 0,
+// which starts from base and doubles after each retry, up to max.
+func backoff(base, max time.Duration, attempt int) time.Duration {
+	d := base
+	for ; attempt > 0 && d < max; attempt-- {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// Flush cuts the current batch, and waits until all the batches queued
+// before calling it are written, then flushes the underlying writer
+// if it is a Flusher.
+//
+// It returns ErrBatchWriterTimeout if the batches are not written
+// in conf.DrainTimeout.
+func (b *BatchWriter) Flush() error {
+	timer := time.NewTimer(b.conf.DrainTimeout)
+	defer timer.Stop()
+
+	b.lock.Lock()
+	if !b.closed {
+		b.cut()
+	}
+	b.lock.Unlock()
+
+	if !b.counter.Wait(b.counter.Target(), timer.C) {
+		return ErrBatchWriterTimeout
+	}
+
+	if f, ok := b.w.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Close writes the current batch and waits until all the queued batches
+// are written, then closes the underlying writer if it is an io.Closer.
+//
+// If the batches are not written in conf.DrainTimeout, it returns
+// ErrBatchWriterTimeout, the queued batches and the batch waiting for
+// the retry are dropped and counted by Failed, and the underlying writer
+// won't be closed because it may be still being written.
+func (b *BatchWriter) Close() (err error) {
+	timer := time.NewTimer(b.conf.DrainTimeout)
+	defer timer.Stop()
+
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return nil
+	}
+	b.cut()
+	b.closed = true
+	b.cond.Broadcast()
+	b.lock.Unlock()
+
+	select {
+	case <-b.exited:
+	case <-timer.C:
+		b.lock.Lock()
+		dropped := b.pending
+		b.pending = nil
+		close(b.abort)
+		b.lock.Unlock()
+
+		for _, batch := range dropped {
+			atomic.AddUint64(&b.failed, uint64(batch.count))
+			if b.conf.ErrorHandler != nil {
+				b.conf.ErrorHandler(batch.data, ErrBatchWriterTimeout)
+			}
+			b.counter.Done()
+		}
+		return ErrBatchWriterTimeout
+	}
+
+	if c, ok := b.w.(io.Closer); ok {
+		err = c.Close()
+	}
+	return
+}
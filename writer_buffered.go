@@ -0,0 +1,208 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// BufferedFileWriterConfig is used to configure the buffered file writer.
+type BufferedFileWriterConfig struct {
+	// The size of the buffer, which is 64KB by default. If the buffered data
+	// will exceed it, they are flushed into the underlying writer.
+	BufferSize int
+
+	// The interval to flush the buffered data periodically, which is 1s
+	// by default. If it's negative, it won't be flushed periodically.
+	FlushInterval time.Duration
+
+	// The buffered data are flushed immediately when writing the log
+	// whose level is not less than FlushLevel by WriteLevel,
+	// which is LvlError by default.
+	//
+	// Notice: because LvlTrace is the zero value, it cannot be used.
+	FlushLevel Level
+}
+
+// BufferedFileWriter returns a writer with an in-memory buffer in front of w,
+// which is typically returned by FileWriter, SizedRotatingFileWriter
+// or TimedRotatingFileWriter, so that many records are written into the file
+// by one write syscall.
+//
+// The buffered data are flushed into w when the buffer is full, every
+// conf.FlushInterval, or when writing the log whose level is not less than
+// conf.FlushLevel. Every write of w contains only the whole records,
+// so the rotating file writer never splits a record into two files.
+//
+// The returned writer has also implemented LevelWriter and Flusher. Flush
+// flushes the buffered data into w, then calls the method Flush of w if it's
+// a Flusher. If w is a Rotator or Reopener, the buffered data will be flushed
+// before calling the method Rotate or Reopen of w.
+//
+// The returned closer flushes the buffered data, stops the periodic flush,
+// and closes w if it is an io.Closer.
+//
+// It is thread-safe for concurrent writes.
+func BufferedFileWriter(w Writer, conf ...BufferedFileWriterConfig) (Writer, io.Closer) {
+	var c BufferedFileWriterConfig
+	if len(conf) > 0 {
+		c = conf[0]
+	}
+	if c.BufferSize <= 0 {
+		c.BufferSize = 64 * 1024
+	}
+	if c.FlushInterval == 0 {
+		c.FlushInterval = time.Second
+	}
+	if c.FlushLevel == LvlTrace {
+		c.FlushLevel = LvlError
+	}
+
+	bw := &bufferedFile{w: w, conf: c, done: make(chan struct{})}
+	bw.buf.Grow(c.BufferSize)
+	if c.FlushInterval > 0 {
+		go bw.loop()
+	}
+	return bw, bw
+}
+
+type bufferedFile struct {
+	sync.Mutex
+	w      Writer
+	conf   BufferedFileWriterConfig
+	buf    bytes.Buffer
+	closed bool
+	done   chan struct{}
+}
+
+func (b *bufferedFile) loop() {
+	ticker := time.NewTicker(b.conf.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.Lock()
+			if !b.closed {
+				b.flush()
+			}
+			b.Unlock()
+		case <-b.done:
+			return
+		}
+	}
+}
+
+func (b *bufferedFile) Write(p []byte) (int, error) {
+	return b.write(p, false)
+}
+
+func (b *bufferedFile) WriteLevel(level Level, p []byte) (int, error) {
+	return b.write(p, level >= b.conf.FlushLevel)
+}
+
+func (b *bufferedFile) write(p []byte, flush bool) (n int, err error) {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.closed {
+		return 0, errFileClosed
+	}
+
+	if b.buf.Len() > 0 && b.buf.Len()+len(p) > b.conf.BufferSize {
+		if err = b.flush(); err != nil {
+			return
+		}
+	}
+
+	if len(p) >= b.conf.BufferSize {
+		return b.w.Write(p)
+	}
+
+	n, _ = b.buf.Write(p)
+	if flush {
+		err = b.flush()
+	}
+	return
+}
+
+// flush writes the buffered data into the underlying writer. If failing,
+// the buffered data are discarded, which is the same as writing the records
+// into the underlying writer directly.
+func (b *bufferedFile) flush() (err error) {
+	if b.buf.Len() > 0 {
+		_, err = b.w.Write(b.buf.Bytes())
+		b.buf.Reset()
+	}
+	return
+}
+
+func (b *bufferedFile) Flush() (err error) {
+	b.Lock()
+	defer b.Unlock()
+
+	if err = b.flush(); err == nil {
+		if f, ok := b.w.(Flusher); ok {
+			err = f.Flush()
+		}
+	}
+	return
+}
+
+func (b *bufferedFile) Rotate() (err error) {
+	b.Lock()
+	defer b.Unlock()
+
+	if err = b.flush(); err == nil {
+		if r, ok := b.w.(Rotator); ok {
+			err = r.Rotate()
+		}
+	}
+	return
+}
+
+func (b *bufferedFile) Reopen() (err error) {
+	b.Lock()
+	defer b.Unlock()
+
+	if err = b.flush(); err == nil {
+		if r, ok := b.w.(Reopener); ok {
+			err = r.Reopen()
+		}
+	}
+	return
+}
+
+func (b *bufferedFile) Close() (err error) {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.closed {
+		return nil
+	}
+
+	b.closed = true
+	close(b.done)
+	err = b.flush()
+	if c, ok := b.w.(io.Closer); ok {
+		if e := c.Close(); err == nil {
+			err = e
+		}
+	}
+	return
+}
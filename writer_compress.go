@@ -0,0 +1,199 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"sync"
+)
+
+// FileCompressor is used to compress the rotated log files.
+//
+// You can implement it to support other compression formats, such as zstd.
+type FileCompressor interface {
+	// Ext returns the extension of the compressed file, such as ".gz".
+	Ext() string
+
+	// Compress compresses the data read from src and writes it into dst.
+	Compress(dst io.Writer, src io.Reader) error
+}
+
+// GzipCompressor returns a FileCompressor based on gzip, the extension
+// of which is ".gz".
+//
+// level is the compression level of gzip, which is gzip.DefaultCompression
+// by default.
+func GzipCompressor(level ...int) FileCompressor {
+	_level := gzip.DefaultCompression
+	if len(level) > 0 {
+		_level = level[0]
+	}
+	return gzipCompressor(_level)
+}
+
+type gzipCompressor int
+
+func (c gzipCompressor) Ext() string {
+	return ".gz"
+}
+
+func (c gzipCompressor) Compress(dst io.Writer, src io.Reader) error {
+	w, err := gzip.NewWriterLevel(dst, int(c))
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, src); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// backupCompressor compresses the rotated log files in the background.
+//
+// It counts the running compressions by itself instead of sync.WaitGroup,
+// because Wait may be called when a new compression is started.
+type backupCompressor struct {
+	compressor FileCompressor
+
+	lock sync.Mutex
+	cond *sync.Cond
+	busy int
+}
+
+func newBackupCompressor(c FileCompressor) *backupCompressor {
+	if c == nil {
+		return nil
+	}
+	bc := &backupCompressor{compressor: c}
+	bc.cond = sync.NewCond(&bc.lock)
+	return bc
+}
+
+// Ext returns the extension of the compressed file. It's "" if c is nil.
+func (c *backupCompressor) Ext() string {
+	if c == nil {
+		return ""
+	}
+	return c.compressor.Ext()
+}
+
+// Compress compresses the file in a new goroutine, then calls after
+// if it is not nil.
+//
+// If c is nil, it only calls after synchronously.
+func (c *backupCompressor) Compress(filename string, after func()) {
+	if c == nil {
+		if after != nil {
+			after()
+		}
+		return
+	}
+
+	c.lock.Lock()
+	c.busy++
+	c.lock.Unlock()
+
+	go func() {
+		defer c.done()
+		compressFile(c.compressor, filename)
+		if after != nil {
+			after()
+		}
+	}()
+}
+
+func (c *backupCompressor) done() {
+	c.lock.Lock()
+	if c.busy--; c.busy == 0 {
+		c.cond.Broadcast()
+	}
+	c.lock.Unlock()
+}
+
+// Busy reports whether any file is being compressed. It's false if c is nil.
+func (c *backupCompressor) Busy() bool {
+	if c == nil {
+		return false
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.busy > 0
+}
+
+// Wait waits until all the files have been compressed.
+func (c *backupCompressor) Wait() {
+	if c == nil {
+		return
+	}
+
+	c.lock.Lock()
+	for c.busy > 0 {
+		c.cond.Wait()
+	}
+	c.lock.Unlock()
+}
+
+// compressFile compresses the file into filename+c.Ext() and removes it.
+//
+// The compressed data is written into a temporary file at first, which is
+// renamed to the final name on completion, so nobody sees the partial file.
+// If failing, the original file is kept.
+//
+// The compressed file keeps the modification time of the original, which
+// the retention policy MaxAge depends on.
+func compressFile(c FileCompressor, filename string) (err error) {
+	src, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+
+	info, err := src.Stat()
+	if err != nil {
+		src.Close()
+		return
+	}
+
+	dstname := filename + c.Ext()
+	tmpname := dstname + ".tmp"
+	dst, err := os.OpenFile(tmpname, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
+	if err != nil {
+		src.Close()
+		return
+	}
+
+	if err = c.Compress(dst, src); err == nil {
+		err = dst.Sync()
+	}
+	if e := dst.Close(); err == nil {
+		err = e
+	}
+	src.Close()
+
+	if err == nil {
+		err = os.Chtimes(tmpname, info.ModTime(), info.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(tmpname, dstname)
+	}
+	if err != nil {
+		os.Remove(tmpname)
+		return
+	}
+	return os.Remove(filename)
+}
@@ -0,0 +1,192 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPError is returned by the writer of HTTPWriter when the response status
+// code is not 2xx.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Body       string // The beginning of the response body.
+
+	retryAfter time.Duration
+}
+
+func (e HTTPError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("http response: %s", e.Status)
+	}
+	return fmt.Sprintf("http response: %s: %s", e.Status, e.Body)
+}
+
+// Retryable reports whether the request should be retried,
+// which is true only for 429 and 5xx.
+func (e HTTPError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// RetryAfter returns the interval parsed from the response header
+// "Retry-After", which is 0 if missing or invalid.
+func (e HTTPError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// parseRetryAfter parses the value of the header "Retry-After",
+// which is either the delay seconds or the HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value = strings.TrimSpace(value); value == "" {
+		return 0
+	}
+
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// HTTPWriterConfig is used to configure the HTTP writer.
+type HTTPWriterConfig struct {
+	// The configuration of the batches. See BatchWriterConfig.
+	Batch BatchWriterConfig
+
+	// The client to send the requests, which is the client with the 10s
+	// timeout by default.
+	Client *http.Client
+
+	// The extra headers of each request, which may override the default
+	// "Content-Type", such as "application/x-ndjson" for HTTPWriter.
+	Header http.Header
+
+	// If not empty, use the HTTP basic authentication.
+	Username string
+	Password string
+
+	// If not empty, set the header "Authorization: Bearer <BearerToken>".
+	BearerToken string
+
+	// If true, compress the request body by gzip.
+	Gzip bool
+}
+
+// HTTPWriter returns a BatchWriter which POSTs the batches of the records
+// to the url as NDJSON, that's, one JSON record per line, which is accepted
+// by many log backends, such as the http sources of vector and fluent-bit.
+// So the records should be encoded by the JSON encoder, such as
+// NewStdJSONEncoder, which ends each record with the newline.
+//
+// The batches are retried with backoff when failing to send them, or
+// the response status code is 429 or 5xx, and the interval in the response
+// header "Retry-After" is honored up to conf.Batch.MaxRetryInterval.
+// For the other status codes, the batch is dropped with the HTTPError.
+//
+// If the queue is full, Write blocks. Close sends the remaining records,
+// and waits for them up to conf.Batch.DrainTimeout.
+func HTTPWriter(url string, conf ...HTTPWriterConfig) *BatchWriter {
+	var c HTTPWriterConfig
+	if len(conf) > 0 {
+		c = conf[0]
+	}
+	return NewBatchWriter(newHTTPSender(url, c, "application/x-ndjson"), c.Batch)
+}
+
+// httpSender POSTs each batch to the url.
+type httpSender struct {
+	url   string
+	conf  HTTPWriterConfig
+	ctype string
+}
+
+func newHTTPSender(url string, conf HTTPWriterConfig, contentType string) *httpSender {
+	if conf.Client == nil {
+		conf.Client = &http.Client{Timeout: time.Second * 10}
+	}
+	return &httpSender{url: url, conf: conf, ctype: contentType}
+}
+
+func (s *httpSender) Write(p []byte) (n int, err error) {
+	body := p
+	if s.conf.Gzip {
+		buf := bytes.NewBuffer(make([]byte, 0, len(body)/4))
+		gw := gzip.NewWriter(buf)
+		if _, err = gw.Write(body); err == nil {
+			err = gw.Close()
+		}
+		if err != nil {
+			return
+		}
+		body = buf.Bytes()
+	}
+
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+
+	req.Header.Set("Content-Type", s.ctype)
+	if s.conf.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if s.conf.Username != "" || s.conf.Password != "" {
+		req.SetBasicAuth(s.conf.Username, s.conf.Password)
+	}
+	if s.conf.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.conf.BearerToken)
+	}
+	for key, values := range s.conf.Header {
+		req.Header.Del(key)
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	resp, err := s.conf.Client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return 0, HTTPError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Body:       strings.TrimSpace(string(data)),
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+
+	// Drain the body so that the connection can be reused.
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+	return len(p), nil
+}
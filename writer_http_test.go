@@ -0,0 +1,143 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHTTPWriter(t *testing.T) {
+	var lock sync.Mutex
+	var requests int
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if requests++; requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		user, pass, _ := r.BasicAuth()
+		if user != "user" || pass != "pass" || r.Header.Get("X-Tenant") != "test" ||
+			r.Header.Get("Content-Type") != "application/x-ndjson" ||
+			r.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("unexpected request headers: %v", r.Header)
+		}
+
+		gr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		data, _ := ioutil.ReadAll(gr)
+		bodies = append(bodies, string(data))
+	}))
+	defer server.Close()
+
+	w := HTTPWriter(server.URL, HTTPWriterConfig{
+		Batch:    BatchWriterConfig{MaxRecords: 2, RetryInterval: time.Millisecond},
+		Header:   http.Header{"X-Tenant": []string{"test"}},
+		Username: "user",
+		Password: "pass",
+		Gzip:     true,
+	})
+
+	valuers := map[string]Valuer{"time": func(r Record) (interface{}, error) { return "t", nil }}
+	logger := New(NewStdJSONEncoder(w, JSONEncoderConfig{Valuers: valuers}))
+	logger.Info("a")
+	logger.Info("b")
+	logger.Info("c") // Sent by Close.
+	if err := w.Close(); err != nil {
+		t.Error(err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if requests != 3 || len(bodies) != 2 ||
+		bodies[0] != `{"level":"INFO","msg":"a","time":"t"}`+"\n"+`{"level":"INFO","msg":"b","time":"t"}`+"\n" ||
+		bodies[1] != `{"level":"INFO","msg":"c","time":"t"}`+"\n" {
+		t.Errorf("unexpected %d requests: %q", requests, bodies)
+	}
+}
+
+func TestHTTPWriterError(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "invalid record", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	var err error
+	w := HTTPWriter(server.URL, HTTPWriterConfig{Batch: BatchWriterConfig{
+		ErrorHandler: func(batch []byte, e error) { err = e },
+	}})
+	w.Write([]byte("{}\n"))
+	w.Close()
+
+	if e, ok := err.(HTTPError); !ok || e.StatusCode != 400 || e.Body != "invalid record" {
+		t.Errorf("unexpected error: %v", err)
+	} else if requests != 1 || w.Failed() != 1 {
+		t.Errorf("unexpected %d requests and %d failed records", requests, w.Failed())
+	}
+}
+
+func TestHTTPWriterHeader(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+	}))
+	defer server.Close()
+
+	// The keys are canonicalized, and override the default headers.
+	w := HTTPWriter(server.URL, HTTPWriterConfig{Header: http.Header{
+		"content-type": []string{"application/json"},
+		"x-tags":       []string{"a", "b"},
+	}})
+	w.Write([]byte("{}\n"))
+	w.Close()
+
+	if ctype := header["Content-Type"]; !reflect.DeepEqual(ctype, []string{"application/json"}) {
+		t.Errorf("unexpected Content-Type: %q", ctype)
+	} else if tags := header["X-Tags"]; !reflect.DeepEqual(tags, []string{"a", "b"}) {
+		t.Errorf("unexpected X-Tags: %q", tags)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	for value, expected := range map[string]time.Duration{
+		"":                              0,
+		"-1":                            0,
+		"120":                           time.Minute * 2,
+		"Wed, 02 Jan 2019 03:04:35 GMT": time.Second * 30,
+		"Wed, 02 Jan 2019 03:04:00 GMT": 0,
+		"invalid":                       0,
+	} {
+		if d := parseRetryAfter(value, now); d != expected {
+			t.Errorf("%q: expect %s, but got %s", value, expected, d)
+		}
+	}
+}
@@ -0,0 +1,405 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Some errors returned by ResilientNetWriter.
+var (
+	ErrNetWriterClosed  = errors.New("the net writer has been closed")
+	ErrNetWriterTimeout = errors.New("timeout to drain the net writer")
+)
+
+// NetState is the state of the connection of ResilientNetWriter.
+type NetState int32
+
+// Predefine some connection states.
+const (
+	NetDisconnected NetState = iota
+	NetConnecting
+	NetConnected
+)
+
+func (s NetState) String() string {
+	switch s {
+	case NetDisconnected:
+		return "disconnected"
+	case NetConnecting:
+		return "connecting"
+	case NetConnected:
+		return "connected"
+	default:
+		return fmt.Sprintf("NetState(%d)", int32(s))
+	}
+}
+
+// ResilientNetWriterConfig is used to configure the resilient net writer.
+type ResilientNetWriterConfig struct {
+	// The maximum number of the records in the queue, which is 1024 by default.
+	// If the queue is full, the records being written are dropped.
+	QueueSize int
+
+	// The timeout to dial the address, which is 10s by default.
+	DialTimeout time.Duration
+
+	// The deadline of each write of the connection, which is 10s by default.
+	WriteTimeout time.Duration
+
+	// The reconnect interval starts from RetryInterval, which is 100ms
+	// by default, and doubles after each failure, up to MaxRetryInterval,
+	// which is 30s by default. The random jitter of up to the half of
+	// the interval is applied.
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+
+	// The timeout for Flush and Close to wait for the queued records to be
+	// written, which is 10s by default.
+	DrainTimeout time.Duration
+
+	// If not nil, use TLS to connect to the address. See LoadTLSConfig.
+	TLSConfig *tls.Config
+
+	// If not nil, it is called when failing to dial or write the connection.
+	ErrorHandler func(err error)
+
+	// If not nil, it is called when the state of the connection changes.
+	StateHandler func(old, new NetState)
+}
+
+// LoadTLSConfig returns a new tls.Config with the CA certificates to verify
+// the server, and the client certificate to be verified by the server.
+//
+// If caFile is empty, use the system CA certificates. If certFile is empty,
+// don't use the client certificate.
+func LoadTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	conf := &tls.Config{}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no CA certificate in '%s'", caFile)
+		}
+	}
+
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	return conf, nil
+}
+
+// ResilientNetWriter writes the records over the connection to the address
+// in a background goroutine. Unlike NetWriter, which dials only once,
+// it dials lazily when there are the records to be written, and reconnects
+// with exponential backoff and jitter after the connection drops.
+//
+// While disconnected, the records are held in the bounded queue. Every write
+// of the connection has a deadline, so the hung peer cannot block it forever,
+// and Write never blocks the goroutine emitting the log.
+//
+// The record which fails to be written is written once more after
+// reconnecting, then dropped if failing again. So for the stream connection,
+// such as TCP, the record may be duplicated or truncated on the peer.
+type ResilientNetWriter struct {
+	dropped    uint64
+	failed     uint64
+	reconnects uint64
+	state      int32
+	closed     int32
+
+	network string
+	addr    string
+	conf    ResilientNetWriterConfig
+	conn    net.Conn
+	dialed  bool
+
+	queue   chan []byte
+	abort   chan struct{}
+	done    chan struct{}
+	exited  chan struct{}
+	counter *asyncCounter
+}
+
+// NewResilientNetWriter returns a new ResilientNetWriter to write
+// the records to the address.
+//
+// It is thread-safe for concurrent writes.
+func NewResilientNetWriter(network, addr string, conf ...ResilientNetWriterConfig) *ResilientNetWriter {
+	var c ResilientNetWriterConfig
+	if len(conf) > 0 {
+		c = conf[0]
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = 1024
+	}
+	if c.DialTimeout <= 0 {
+		c.DialTimeout = time.Second * 10
+	}
+	if c.WriteTimeout <= 0 {
+		c.WriteTimeout = time.Second * 10
+	}
+	if c.RetryInterval <= 0 {
+		c.RetryInterval = time.Millisecond * 100
+	}
+	if c.MaxRetryInterval <= 0 {
+		c.MaxRetryInterval = time.Second * 30
+	}
+	if c.DrainTimeout <= 0 {
+		c.DrainTimeout = time.Second * 10
+	}
+
+	w := &ResilientNetWriter{
+		network: network,
+		addr:    addr,
+		conf:    c,
+		queue:   make(chan []byte, c.QueueSize),
+		abort:   make(chan struct{}),
+		done:    make(chan struct{}),
+		exited:  make(chan struct{}),
+		counter: newAsyncCounter(),
+	}
+	go w.loop()
+	return w
+}
+
+// State returns the current state of the connection.
+func (w *ResilientNetWriter) State() NetState {
+	return NetState(atomic.LoadInt32(&w.state))
+}
+
+// Dropped returns the number of the records dropped because the queue is full,
+// or the writer is closed before they are written.
+func (w *ResilientNetWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// Failed returns the number of the records dropped because they fail
+// to be written into the connection.
+func (w *ResilientNetWriter) Failed() uint64 {
+	return atomic.LoadUint64(&w.failed)
+}
+
+// Reconnects returns the number of the times to reconnect successfully
+// after the first connection.
+func (w *ResilientNetWriter) Reconnects() uint64 {
+	return atomic.LoadUint64(&w.reconnects)
+}
+
+// Queued returns the number of the records in the queue.
+func (w *ResilientNetWriter) Queued() int {
+	return len(w.queue)
+}
+
+// Write implements the interface Writer.
+//
+// It does not return the error even if the record is dropped,
+// except that the writer has been closed.
+func (w *ResilientNetWriter) Write(p []byte) (int, error) {
+	if atomic.LoadInt32(&w.closed) != 0 {
+		return 0, ErrNetWriterClosed
+	}
+
+	data := append([]byte(nil), p...)
+	put := func() bool {
+		select {
+		case w.queue <- data:
+			return true
+		default:
+			return false
+		}
+	}
+
+	if !w.counter.Enqueue(put) {
+		atomic.AddUint64(&w.dropped, 1)
+	}
+	return len(p), nil
+}
+
+func (w *ResilientNetWriter) loop() {
+	defer close(w.exited)
+	defer w.disconnect()
+
+	for {
+		select {
+		case data := <-w.queue:
+			w.send(data)
+			w.counter.Done()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// send writes the data into the connection, and reconnects if necessary
+// until the writer is aborted.
+func (w *ResilientNetWriter) send(data []byte) {
+	for attempt, writes := 0, 0; ; {
+		if w.conn == nil {
+			select {
+			case <-w.abort:
+				atomic.AddUint64(&w.dropped, 1)
+				return
+			default:
+			}
+
+			if err := w.connect(); err != nil {
+				w.handleError(err)
+
+				timer := time.NewTimer(w.retryInterval(attempt))
+				select {
+				case <-timer.C:
+					attempt++
+					continue
+				case <-w.abort:
+					timer.Stop()
+					atomic.AddUint64(&w.dropped, 1)
+					return
+				}
+			}
+			attempt = 0
+		}
+
+		w.conn.SetWriteDeadline(time.Now().Add(w.conf.WriteTimeout))
+		_, err := w.conn.Write(data)
+		if err == nil {
+			return
+		}
+
+		w.handleError(err)
+		w.disconnect()
+		if writes++; writes > 1 {
+			atomic.AddUint64(&w.failed, 1)
+			return
+		}
+	}
+}
+
+// retryInterval returns the interval before the attempt-th reconnect
+// starting from 0 with the random jitter.
+func (w *ResilientNetWriter) retryInterval(attempt int) time.Duration {
+	d := backoff(w.conf.RetryInterval, w.conf.MaxRetryInterval, attempt)
+	if jitter := int64(d / 2); jitter > 0 {
+		d = d - time.Duration(jitter) + time.Duration(rand.Int63n(jitter+1))
+	}
+	return d
+}
+
+func (w *ResilientNetWriter) connect() (err error) {
+	w.setState(NetConnecting)
+
+	dialer := &net.Dialer{Timeout: w.conf.DialTimeout}
+	if w.conf.TLSConfig != nil {
+		w.conn, err = tls.DialWithDialer(dialer, w.network, w.addr, w.conf.TLSConfig)
+	} else {
+		w.conn, err = dialer.Dial(w.network, w.addr)
+	}
+
+	if err != nil {
+		w.conn = nil
+		w.setState(NetDisconnected)
+		return
+	}
+
+	if w.dialed {
+		atomic.AddUint64(&w.reconnects, 1)
+	}
+	w.dialed = true
+	w.setState(NetConnected)
+	return
+}
+
+func (w *ResilientNetWriter) disconnect() {
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+		w.setState(NetDisconnected)
+	}
+}
+
+func (w *ResilientNetWriter) setState(state NetState) {
+	old := NetState(atomic.SwapInt32(&w.state, int32(state)))
+	if old != state && w.conf.StateHandler != nil {
+		w.conf.StateHandler(old, state)
+	}
+}
+
+func (w *ResilientNetWriter) handleError(err error) {
+	if w.conf.ErrorHandler != nil {
+		w.conf.ErrorHandler(err)
+	}
+}
+
+// drain waits until all the records queued before calling it are written.
+func (w *ResilientNetWriter) drain(timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	if !w.counter.Wait(w.counter.Target(), timer.C) {
+		return ErrNetWriterTimeout
+	}
+	return nil
+}
+
+// Flush waits until all the records queued before calling it are written.
+//
+// It returns ErrNetWriterTimeout if the records are not written
+// in conf.DrainTimeout, for example, because of being disconnected.
+func (w *ResilientNetWriter) Flush() error {
+	return w.drain(w.conf.DrainTimeout)
+}
+
+// Close stops receiving the new records, waits until the queued records
+// are written, then closes the connection.
+//
+// If the queued records are not written in conf.DrainTimeout, it returns
+// ErrNetWriterTimeout and the remaining records are dropped.
+func (w *ResilientNetWriter) Close() (err error) {
+	if !atomic.CompareAndSwapInt32(&w.closed, 0, 1) {
+		return nil
+	}
+
+	if err = w.drain(w.conf.DrainTimeout); err != nil {
+		close(w.abort)
+	}
+	close(w.done)
+	<-w.exited
+
+	// Drop the records which have not been written.
+	for n := len(w.queue); n > 0; n-- {
+		select {
+		case <-w.queue:
+			atomic.AddUint64(&w.dropped, 1)
+		default:
+		}
+	}
+	return
+}
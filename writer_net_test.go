@@ -0,0 +1,158 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResilientNetWriter(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	var lock sync.Mutex
+	var states []NetState
+	var errs int
+	w := NewResilientNetWriter("tcp", addr, ResilientNetWriterConfig{
+		RetryInterval:    time.Millisecond,
+		MaxRetryInterval: time.Millisecond * 10,
+		DrainTimeout:     time.Millisecond * 50,
+		ErrorHandler:     func(error) { lock.Lock(); errs++; lock.Unlock() },
+		StateHandler: func(old, new NetState) {
+			lock.Lock()
+			states = append(states, new)
+			lock.Unlock()
+		},
+	})
+	defer w.Close()
+
+	// The records are held while disconnected.
+	w.Write([]byte("a\n"))
+	w.Write([]byte("b\n"))
+	if err := w.Flush(); err != ErrNetWriterTimeout {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if ln, err = net.Listen("tcp", addr); err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	for _, expected := range []string{"a\n", "b\n"} {
+		if line, err := reader.ReadString('\n'); err != nil || line != expected {
+			t.Errorf("expect %q, but got %q: %v", expected, line, err)
+		}
+	}
+
+	lock.Lock()
+	if errs == 0 || len(states) < 3 || states[len(states)-1] != NetConnected {
+		t.Errorf("unexpected %d errors and states %v", errs, states)
+	}
+	lock.Unlock()
+
+	// Reconnect after the connection drops.
+	conn.Close()
+	accepted := make(chan net.Conn)
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	for {
+		w.Write([]byte("c\n"))
+		select {
+		case conn = <-accepted:
+		case <-time.After(time.Millisecond * 10):
+			continue
+		}
+		break
+	}
+	defer conn.Close()
+
+	if line, err := bufio.NewReader(conn).ReadString('\n'); err != nil || line != "c\n" {
+		t.Errorf("expect %q, but got %q: %v", "c\n", line, err)
+	}
+	if w.Reconnects() != 1 {
+		t.Errorf("expect 1 reconnect, but got %d", w.Reconnects())
+	}
+}
+
+func TestResilientNetWriterTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(nil)
+	server.StartTLS()
+	cert := server.TLS.Certificates[0]
+	server.Close()
+
+	dir, err := ioutil.TempDir("", "logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	if err = ioutil.WriteFile(caFile, ca, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	conf, err := LoadTLSConfig(caFile, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.ServerName = "example.com"
+
+	w := NewResilientNetWriter("tcp", ln.Addr().String(), ResilientNetWriterConfig{TLSConfig: conf})
+	defer w.Close()
+	w.Write([]byte("abc\n"))
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if line, err := bufio.NewReader(conn).ReadString('\n'); err != nil || line != "abc\n" {
+		t.Errorf("expect %q, but got %q: %v", "abc\n", line, err)
+	}
+	if w.State() != NetConnected {
+		t.Errorf("unexpected state '%s'", w.State())
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var errFileClosed = errors.New("the file has been closed")
+
+// Rotator is used to rotate the log file on demand.
+//
+// The writers returned by SizedRotatingFileWriter and TimedRotatingFileWriter
+// have implemented it.
+type Rotator interface {
+	Rotate() error
+}
+
+// Reopener is used to reopen the log file, for example, after it has been
+// moved by logrotate.
+//
+// The writers returned by FileWriter, SignalReopenFileWriter,
+// SizedRotatingFileWriter and TimedRotatingFileWriter have implemented it.
+type Reopener interface {
+	Reopen() error
+}
+
+var fileWriters = struct {
+	sync.Mutex
+	writers map[Reopener]struct{}
+}{writers: make(map[Reopener]struct{})}
+
+func registerFileWriter(w Reopener) {
+	fileWriters.Lock()
+	fileWriters.writers[w] = struct{}{}
+	fileWriters.Unlock()
+}
+
+func unregisterFileWriter(w Reopener) {
+	fileWriters.Lock()
+	delete(fileWriters.writers, w)
+	fileWriters.Unlock()
+}
+
+// ReopenFileWriters reopens all the file writers which have not been closed,
+// which are returned by FileWriter, SignalReopenFileWriter,
+// SizedRotatingFileWriter and TimedRotatingFileWriter.
+//
+// It reopens all of them even if some fail, and returns the first error.
+//
+// Notice: the file writers are registered until they are closed, so they
+// must be closed by the returned io.Closer when no longer used, or they are
+// never garbage-collected, and still reopened by it.
+func ReopenFileWriters() (err error) {
+	fileWriters.Lock()
+	writers := make([]Reopener, 0, len(fileWriters.writers))
+	for w := range fileWriters.writers {
+		writers = append(writers, w)
+	}
+	fileWriters.Unlock()
+
+	for _, w := range writers {
+		if e := w.Reopen(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+// SignalReopenFileWriter is the same as FileWriter, but reopens the file
+// when receiving any of the signals, which is syscall.SIGHUP by default.
+// So it can be used with the "postrotate" script of logrotate, such as
+//
+//     postrotate
+//         kill -HUP `cat /var/run/app.pid`
+//     endscript
+//
+// Notice: the file mode is 0644.
+func SignalReopenFileWriter(path string, sigs ...os.Signal) (Writer, io.Closer, error) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+
+	f, err := newReopenFile(path, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w := &signalReopenFile{reopenFile: f, done: make(chan struct{})}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, sigs...)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-signals:
+				w.Reopen()
+			case <-w.done:
+				return
+			}
+		}
+	}()
+
+	return w, w, nil
+}
+
+type signalReopenFile struct {
+	*reopenFile
+	once sync.Once
+	done chan struct{}
+}
+
+func (f *signalReopenFile) Close() error {
+	f.once.Do(func() { close(f.done) })
+	return f.reopenFile.Close()
+}
+
+// reopenFile is a file which can be reopened.
+type reopenFile struct {
+	sync.Mutex
+	file *os.File
+	path string
+	mode os.FileMode
+}
+
+func newReopenFile(path string, mode os.FileMode) (*reopenFile, error) {
+	file, err := os.OpenFile(path, fileFlag, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &reopenFile{file: file, path: path, mode: mode}
+	registerFileWriter(f)
+	return f, nil
+}
+
+func (f *reopenFile) Write(p []byte) (n int, err error) {
+	f.Lock()
+	if f.file == nil {
+		err = errFileClosed
+	} else {
+		n, err = f.file.Write(p)
+	}
+	f.Unlock()
+	return
+}
+
+func (f *reopenFile) Flush() (err error) {
+	f.Lock()
+	if f.file != nil {
+		err = f.file.Sync()
+	}
+	f.Unlock()
+	return
+}
+
+func (f *reopenFile) Close() (err error) {
+	unregisterFileWriter(f)
+	f.Lock()
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.Unlock()
+	return
+}
+
+// Reopen opens the file by the path again, then closes the old one.
+// If failing to open it, the old one is still used.
+func (f *reopenFile) Reopen() error {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.file == nil {
+		return errFileClosed
+	}
+
+	file, err := os.OpenFile(f.path, fileFlag, f.mode)
+	if err != nil {
+		return err
+	}
+
+	f.file.Close()
+	f.file = file
+	return nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !windows
+
+package logger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSignalReopenFileWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "app.log")
+	w, c, err := SignalReopenFileWriter(filename, syscall.SIGUSR1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	w.Write([]byte("abc\n"))
+	if err = os.Rename(filename, filename+".1"); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+
+	for i := 0; i < 100 && !fileIsExist(filename); i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	w.Write([]byte("def\n"))
+
+	for name, expect := range map[string]string{"app.log": "def\n", "app.log.1": "abc\n"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Error(err)
+		} else if string(data) != expect {
+			t.Errorf("%s: expect '%s', but got '%s'", name, expect, data)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// retention is the retention policy of the rotated log files.
+type retention struct {
+	MaxAge       time.Duration
+	MaxTotalSize int64
+}
+
+func (r retention) IsZero() bool {
+	return r.MaxAge <= 0 && r.MaxTotalSize <= 0
+}
+
+type backupFile struct {
+	name string
+	info os.FileInfo
+}
+
+type backupFiles []backupFile
+
+func (fs backupFiles) Len() int      { return len(fs) }
+func (fs backupFiles) Swap(i, j int) { fs[i], fs[j] = fs[j], fs[i] }
+func (fs backupFiles) Less(i, j int) bool {
+	return fs[i].info.ModTime().After(fs[j].info.ModTime())
+}
+
+// Apply removes the backups modified before MaxAge ago, then removes
+// the oldest backups until the total size of the backups and the active file
+// is not greater than MaxTotalSize.
+//
+// names should be sorted from the newest to the oldest, which is used to
+// decide the order of the files with the same modification time.
+//
+// The active file, the files which are not the regular files, such as
+// the symbolic links, and the temporary files with the suffix ".tmp"
+// are ignored.
+func (r retention) Apply(names []string, active string, now time.Time) {
+	if r.IsZero() {
+		return
+	}
+
+	var total int64
+	if info, err := os.Stat(active); err == nil {
+		total = info.Size()
+	}
+
+	files := make(backupFiles, 0, len(names))
+	for _, name := range names {
+		if name == active || strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+		if info, err := os.Lstat(name); err == nil && info.Mode().IsRegular() {
+			files = append(files, backupFile{name: name, info: info})
+		}
+	}
+	sort.Stable(files)
+
+	for _, f := range files {
+		total += f.info.Size()
+		if (r.MaxAge > 0 && now.Sub(f.info.ModTime()) > r.MaxAge) ||
+			(r.MaxTotalSize > 0 && total > r.MaxTotalSize) {
+			os.Remove(f.name)
+		}
+	}
+}
+
+// globEscape escapes the meta characters of filepath.Match in s.
+func globEscape(s string) string {
+	if !strings.ContainsAny(s, `*?[\`) {
+		return s
+	}
+
+	buf := make([]byte, 0, len(s)+8)
+	for i := 0; i < len(s); i++ {
+		buf = appendGlobChar(buf, s[i])
+	}
+	return string(buf)
+}
+
+// appendGlobChar appends c into the pattern of filepath.Match, which escapes
+// '*', '?' and '[' by the brackets, and the backslash by another one except
+// on Windows, where it is the path separator instead of the escape character.
+func appendGlobChar(buf []byte, c byte) []byte {
+	switch c {
+	case '*', '?', '[':
+		return append(buf, '[', c, ']')
+	case '\\':
+		if os.PathSeparator != '\\' {
+			return append(buf, '\\', c)
+		}
+	}
+	return append(buf, c)
+}
+
+// filenameGlob converts the filename pattern of TimedRotatingFileWriter
+// to the pattern of filepath.Match, which replaces the conversion
+// specifications with the digits of the same widths, such as "%Y" with
+// "[0-9][0-9][0-9][0-9]", so that the unrelated files are not matched.
+func filenameGlob(pattern string) string {
+	const digit = "[0-9]"
+
+	buf := make([]byte, 0, len(pattern)+32)
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c == '%' && i+1 < len(pattern) {
+			i++
+			switch c = pattern[i]; c {
+			case 'Y':
+				buf = append(buf, digit+digit+digit+digit...)
+				continue
+			case 'j':
+				buf = append(buf, digit+digit+digit...)
+				continue
+			case 'y', 'm', 'd', 'H', 'M', 'S':
+				buf = append(buf, digit+digit...)
+				continue
+			case '%':
+			default:
+				buf = append(buf, '%') // Output as it is by formatFilename.
+			}
+		}
+
+		buf = appendGlobChar(buf, c)
+	}
+	return string(buf)
+}
+
+// globFiles returns the names of the files matching any of the patterns.
+func globFiles(patterns ...string) (names []string) {
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches, _ := filepath.Glob(pattern)
+		for _, name := range matches {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return
+}
+
+// isBackupSuffix reports whether s, such as "1", "1.gz" or "1.zst",
+// is the suffix of the backups generated by the rotating file writer.
+func isBackupSuffix(s string) bool {
+	var i int
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i == 0 {
+		return false
+	} else if i == len(s) {
+		return true
+	} else if s[i] != '.' || i+1 == len(s) {
+		return false
+	}
+
+	for _, c := range s[i+1:] {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,783 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func readGzipFile(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadAll(r)
+	return string(data), err
+}
+
+func TestSizedRotatingFileWriterCompress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sized")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "app.log")
+	w, c, err := SizedRotatingFileWriterWithConfig(filename, SizedRotatingFileConfig{
+		MaxSize:     8,
+		BackupCount: 2,
+		Compressor:  GzipCompressor(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{"abcd\n", "efgh\n", "ijkl\n", "mnop\n"} {
+		if _, err = w.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Close()
+	if err = w.(Flusher).Flush(); err != nil {
+		t.Errorf("unexpected the error of Flush after closed: %s", err)
+	}
+
+	if data, err := ioutil.ReadFile(filename); err != nil {
+		t.Error(err)
+	} else if string(data) != "mnop\n" {
+		t.Error(string(data))
+	}
+
+	expects := map[string]string{".1.gz": "ijkl\n", ".2.gz": "efgh\n"}
+	for ext, expect := range expects {
+		if data, err := readGzipFile(filename + ext); err != nil {
+			t.Error(err)
+		} else if data != expect {
+			t.Errorf("%s: expect '%s', but got '%s'", ext, expect, data)
+		}
+	}
+
+	for _, ext := range []string{".1", ".2", ".3", ".3.gz", ".1.gz.tmp"} {
+		if fileIsExist(filename + ext) {
+			t.Errorf("unexpected file '%s'", filename+ext)
+		}
+	}
+}
+
+func TestCompressFileModTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "app.log.1")
+	mtime := time.Date(2019, 5, 16, 0, 0, 0, 0, time.UTC)
+	if err = ioutil.WriteFile(filename, []byte("abcd\n"), 0644); err != nil {
+		t.Fatal(err)
+	} else if err = os.Chtimes(filename, mtime, mtime); err != nil {
+		t.Fatal(err)
+	} else if err = compressFile(GzipCompressor(), filename); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err := os.Stat(filename + ".gz"); err != nil {
+		t.Error(err)
+	} else if !info.ModTime().Equal(mtime) {
+		t.Errorf("expect the modification time %s, but got %s", mtime, info.ModTime())
+	}
+}
+
+type slowCompressor struct {
+	FileCompressor
+	start chan struct{}
+}
+
+func (c slowCompressor) Compress(dst io.Writer, src io.Reader) error {
+	<-c.start
+	return c.FileCompressor.Compress(dst, src)
+}
+
+func TestSizedRotatingFileWriterSlowCompress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sized")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	start := make(chan struct{})
+	filename := filepath.Join(dir, "app.log")
+	w, c, err := SizedRotatingFileWriterWithConfig(filename, SizedRotatingFileConfig{
+		MaxSize:     8,
+		BackupCount: 2,
+		Compressor:  slowCompressor{GzipCompressor(), start},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.Write([]byte("abcd\n"))
+	w.Write([]byte("efgh\n")) // Rotate and compress the backup.
+
+	rotated := make(chan struct{})
+	go func() { w.Write([]byte("ijkl\n")); close(rotated) }() // Wait for the compression.
+	time.Sleep(time.Millisecond * 10)
+
+	written := make(chan struct{})
+	go func() { w.Write([]byte("m\n")); close(written) }()
+	select {
+	case <-written:
+	case <-time.After(time.Second):
+		t.Fatal("the write is blocked by the compression")
+	}
+
+	close(start)
+	<-rotated
+	c.Close()
+
+	expects := map[string]string{"": "ijkl\n", ".1.gz": "efgh\nm\n", ".2.gz": "abcd\n"}
+	for ext, expect := range expects {
+		var data string
+		if ext == "" {
+			bs, _ := ioutil.ReadFile(filename)
+			data = string(bs)
+		} else {
+			data, _ = readGzipFile(filename + ext)
+		}
+		if data != expect {
+			t.Errorf("%s: expect '%s', but got '%s'", ext, expect, data)
+		}
+	}
+}
+
+func TestIsBackupSuffix(t *testing.T) {
+	for s, expect := range map[string]bool{
+		"1": true, "12.gz": true, "3.zst": true,
+		"": false, "gz": false, "1.": false, "1.gz.tmp": false, "1-2": false,
+	} {
+		if isBackupSuffix(s) != expect {
+			t.Errorf("%s: expect %v", s, expect)
+		}
+	}
+}
+
+func TestGlobEscape(t *testing.T) {
+	for _, s := range []string{"a*b", "a?b", "a[b]", `a\b`, `a\*[b`} {
+		pattern := globEscape(s)
+		if ok, err := filepath.Match(pattern, s); err != nil || !ok {
+			t.Errorf("%s: the pattern '%s' does not match it: %v", s, pattern, err)
+		}
+		if ok, _ := filepath.Match(pattern, "axb"); ok {
+			t.Errorf("%s: the pattern '%s' matches 'axb'", s, pattern)
+		}
+	}
+}
+
+func TestSizedRotatingFileWriterRetention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sized")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "app.log")
+	old := time.Now().Add(-time.Hour * 48)
+	for _, ext := range []string{".7", ".3.gz", ".bak"} {
+		ioutil.WriteFile(filename+ext, []byte("old\n"), 0644)
+		os.Chtimes(filename+ext, old, old)
+	}
+
+	w, c, err := SizedRotatingFileWriterWithConfig(filename, SizedRotatingFileConfig{
+		MaxSize:      8,
+		BackupCount:  10,
+		MaxAge:       time.Hour * 24,
+		MaxTotalSize: 14,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fileIsExist(filename+".7") || fileIsExist(filename+".3.gz") {
+		t.Error("the old backups are not removed when starting")
+	}
+	if !fileIsExist(filename + ".bak") {
+		t.Error("the unrelated file is removed")
+	}
+
+	for _, s := range []string{"abcd\n", "efgh\n", "ijkl\n", "mnop\n"} {
+		if _, err = w.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Close()
+
+	for ext, exist := range map[string]bool{"": true, ".1": true, ".2": true, ".3": false} {
+		if fileIsExist(filename+ext) != exist {
+			t.Errorf("%s: expect the existence %v", filename+ext, exist)
+		}
+	}
+}
+
+func TestReopenFileWriters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reopen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "app.log")
+	w, c, err := FileWriter(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	const lines = 1000
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < lines; j++ {
+				w.Write([]byte("0123456789abcdef\n"))
+			}
+		}()
+	}
+
+	for i := 0; i < 10; i++ {
+		backup := fmt.Sprintf("%s.%d", filename, i)
+		if err = os.Rename(filename, backup); err != nil {
+			t.Fatal(err)
+		}
+		if err = ReopenFileWriters(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	var total int
+	files, _ := filepath.Glob(filename + "*")
+	for _, name := range files {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			if line == "" {
+				continue
+			} else if line != "0123456789abcdef" {
+				t.Fatalf("%s: unexpected line '%s'", name, line)
+			}
+			total++
+		}
+	}
+	if total != lines*4 {
+		t.Errorf("expect %d lines, but got %d", lines*4, total)
+	}
+}
+
+func TestRotatingFileWriterRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sized, c1, err := SizedRotatingFileWriter(filepath.Join(dir, "sized.log"), 1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+
+	timed, c2, err := TimedRotatingFileWriter(filepath.Join(dir, "timed.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+
+	for _, w := range []Writer{sized, timed} {
+		w.Write([]byte("abc\n"))
+		if err = w.(Rotator).Rotate(); err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("def\n"))
+	}
+
+	expects := map[string]string{
+		"sized.log": "def\n", "sized.log.1": "abc\n",
+		"timed.log": "abc\n", "timed.log.1": "def\n",
+	}
+	for name, expect := range expects {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Error(err)
+		} else if string(data) != expect {
+			t.Errorf("%s: expect '%s', but got '%s'", name, expect, data)
+		}
+	}
+}
+
+func TestSizedRotatingFileWriterRenameError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "sized.log")
+	w, c, err := SizedRotatingFileWriter(filename, 1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// The non-empty directory cannot be replaced by the backup.
+	os.MkdirAll(filepath.Join(filename+".1", "dir"), 0755)
+	w.Write([]byte("abc\n"))
+	if err = w.(Rotator).Rotate(); err == nil {
+		t.Error("expect an error")
+	}
+	if _, err = w.Write([]byte("def\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	os.RemoveAll(filename + ".1")
+	if err = w.(Rotator).Rotate(); err != nil {
+		t.Fatal(err)
+	} else if data, _ := ioutil.ReadFile(filename + ".1"); string(data) != "abc\ndef\n" {
+		t.Errorf("unexpected backup '%s'", data)
+	}
+}
+
+type recordWriter struct {
+	sync.Mutex
+	writes []string
+	closed bool
+}
+
+func (w *recordWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	w.writes = append(w.writes, string(p))
+	w.Unlock()
+	return len(p), nil
+}
+
+func (w *recordWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func (w *recordWriter) Writes() []string {
+	w.Lock()
+	defer w.Unlock()
+	return append([]string(nil), w.writes...)
+}
+
+func TestBufferedFileWriter(t *testing.T) {
+	rw := &recordWriter{}
+	w, c := BufferedFileWriter(rw, BufferedFileWriterConfig{
+		BufferSize:    16,
+		FlushInterval: -1,
+	})
+	lw := w.(LevelWriter)
+
+	lw.WriteLevel(LvlDebug, []byte("debug1\n"))
+	lw.WriteLevel(LvlInfo, []byte("info1\n"))
+	if writes := rw.Writes(); len(writes) != 0 {
+		t.Errorf("unexpected writes: %q", writes)
+	}
+
+	lw.WriteLevel(LvlDebug, []byte("debug2\n")) // Exceed the buffer size.
+	lw.WriteLevel(LvlError, []byte("error\n"))
+	lw.WriteLevel(LvlDebug, []byte("debug3\n"))
+	c.Close()
+
+	expects := []string{"debug1\ninfo1\n", "debug2\nerror\n", "debug3\n"}
+	if writes := rw.Writes(); len(writes) != len(expects) {
+		t.Errorf("unexpected writes: %q", writes)
+	} else {
+		for i, s := range writes {
+			if s != expects[i] {
+				t.Errorf("%d: expect %q, but got %q", i, expects[i], s)
+			}
+		}
+	}
+
+	if !rw.closed {
+		t.Error("the underlying writer is not closed")
+	}
+	if _, err := w.Write([]byte("abc\n")); err == nil {
+		t.Error("expect an error after closed")
+	}
+}
+
+func TestBufferedFileWriterFlushInterval(t *testing.T) {
+	rw := &recordWriter{}
+	w, c := BufferedFileWriter(rw, BufferedFileWriterConfig{
+		FlushInterval: time.Millisecond * 10,
+	})
+	defer c.Close()
+
+	w.Write([]byte("abc\n"))
+	for i := 0; i < 100 && len(rw.Writes()) == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if writes := rw.Writes(); len(writes) != 1 || writes[0] != "abc\n" {
+		t.Errorf("unexpected writes: %q", writes)
+	}
+}
+
+// gateWriter blocks the writes until the gate is opened.
+type gateWriter struct {
+	recordWriter
+	gate chan struct{}
+}
+
+func (w *gateWriter) Write(p []byte) (int, error) {
+	<-w.gate
+	return w.recordWriter.Write(p)
+}
+
+func TestAsyncWriter(t *testing.T) {
+	gw := &gateWriter{gate: make(chan struct{})}
+	w := NewAsyncWriter(gw, AsyncWriterConfig{QueueSize: 2, Policy: OverflowDropOldest})
+
+	buf := []byte("0\n")
+	for i := 0; i < 6; i++ {
+		buf[0] = byte('0' + i)
+		w.Write(buf) // The buffer is reused like the encoders.
+		if i == 0 {  // Wait until the worker takes the first record.
+			for w.Queued() != 0 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+
+	close(gw.gate)
+	if err := w.Flush(); err != nil {
+		t.Error(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if w.Dropped() != 3 {
+		t.Errorf("expect 3 dropped records, but got %d", w.Dropped())
+	}
+	if writes := strings.Join(gw.Writes(), ""); writes != "0\n4\n5\n" {
+		t.Errorf("unexpected writes: %q", writes)
+	}
+	if !gw.closed {
+		t.Error("the underlying writer is not closed")
+	}
+	if _, err := w.Write(buf); err != ErrAsyncWriterClosed {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestAsyncWriterFlushWithDrops(t *testing.T) {
+	gw := &gateWriter{gate: make(chan struct{})}
+	w := NewAsyncWriter(gw, AsyncWriterConfig{QueueSize: 1, Policy: OverflowDropNewest})
+
+	w.Write([]byte("a\n"))
+	for w.Queued() != 0 { // Wait until the worker takes the first record.
+		time.Sleep(time.Millisecond)
+	}
+	w.Write([]byte("b\n"))
+
+	flushed := make(chan error)
+	go func() { flushed <- w.Flush() }()
+	time.Sleep(time.Millisecond * 10)
+
+	// The records dropped after Flush must not be counted for it.
+	for i := 0; i < 3; i++ {
+		w.Write([]byte("c\n"))
+	}
+	select {
+	case <-flushed:
+		t.Fatal("Flush returns before the queued records are written")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	close(gw.gate)
+	if err := <-flushed; err != nil {
+		t.Error(err)
+	}
+	if writes := strings.Join(gw.Writes(), ""); writes != "a\nb\n" {
+		t.Errorf("unexpected writes: %q", writes)
+	}
+	w.Close()
+}
+
+func TestAsyncWriterPolicies(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowDropNewest, OverflowBlockTimeout} {
+		gw := &gateWriter{gate: make(chan struct{})}
+		w := NewAsyncWriter(gw, AsyncWriterConfig{
+			QueueSize:    1,
+			Policy:       policy,
+			BlockTimeout: time.Millisecond,
+			DrainTimeout: time.Millisecond * 10,
+		})
+
+		w.Write([]byte("0\n"))
+		for w.Queued() != 0 {
+			time.Sleep(time.Millisecond)
+		}
+		for i := 1; i < 5; i++ {
+			w.Write([]byte{byte('0' + i), '\n'})
+		}
+
+		if err := w.Flush(); err != ErrAsyncWriterTimeout {
+			t.Errorf("%d: expect the timeout, but got %v", policy, err)
+		}
+		close(gw.gate)
+		w.Close()
+
+		if w.Dropped() != 3 {
+			t.Errorf("%d: expect 3 dropped records, but got %d", policy, w.Dropped())
+		}
+		if writes := strings.Join(gw.Writes(), ""); writes != "0\n1\n" {
+			t.Errorf("%d: unexpected writes: %q", policy, writes)
+		}
+	}
+}
+
+func TestAsyncWriterSample(t *testing.T) {
+	gw := &gateWriter{gate: make(chan struct{})}
+	w := NewAsyncWriter(gw, AsyncWriterConfig{
+		QueueSize:  1,
+		Policy:     OverflowSample,
+		SampleRate: 1000,
+	})
+
+	w.Write([]byte("0\n"))
+	for w.Queued() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	w.Write([]byte("1\n"))
+
+	// The first overflowing record is kept, so it blocks.
+	done := make(chan struct{})
+	go func() {
+		w.Write([]byte("2\n"))
+		close(done)
+	}()
+	for atomic.LoadUint64(&w.overflows) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	w.Write([]byte("3\n"))
+	w.Write([]byte("4\n"))
+	close(gw.gate)
+	<-done
+	w.Close()
+
+	if w.Dropped() != 2 {
+		t.Errorf("expect 2 dropped records, but got %d", w.Dropped())
+	}
+	if writes := strings.Join(gw.Writes(), ""); writes != "0\n1\n2\n" {
+		t.Errorf("unexpected writes: %q", writes)
+	}
+}
+
+func TestBatchWriter(t *testing.T) {
+	rw := &recordWriter{}
+	w := NewBatchWriter(rw, BatchWriterConfig{
+		MaxRecords: 3,
+		MaxBytes:   8,
+		MaxDelay:   time.Millisecond * 10,
+		Separator:  []byte(","),
+	})
+
+	w.Write([]byte("a"))
+	w.Write([]byte("b"))
+	w.Write([]byte("c")) // Cut by MaxRecords.
+	w.Write([]byte("ddd"))
+	w.Write([]byte("eeeee")) // Cut by MaxBytes before writing it.
+	w.Write([]byte("f"))    // Cut by MaxDelay.
+	time.Sleep(time.Millisecond * 50)
+	w.Write([]byte("g"))
+	if err := w.Close(); err != nil {
+		t.Error(err)
+	}
+
+	expected := []string{"a,b,c", "ddd", "eeeee,f", "g"}
+	if writes := rw.Writes(); fmt.Sprint(writes) != fmt.Sprint(expected) {
+		t.Errorf("expect %q, but got %q", expected, writes)
+	}
+	if !rw.closed {
+		t.Error("the underlying writer is not closed")
+	}
+	if _, err := w.Write([]byte("h")); err != ErrBatchWriterClosed {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestBatchWriterRetry(t *testing.T) {
+	var failures int
+	var batches []string
+	fw := WriterFunc(func(p []byte) (int, error) {
+		if failures++; failures%3 != 0 {
+			return 0, fmt.Errorf("failure %d", failures)
+		}
+		batches = append(batches, string(p))
+		return len(p), nil
+	})
+
+	w := NewBatchWriter(fw, BatchWriterConfig{MaxRetries: 2, RetryInterval: time.Millisecond})
+	w.Write([]byte("a\n"))
+	w.Write([]byte("b\n"))
+	if err := w.Close(); err != nil {
+		t.Error(err)
+	}
+	if fmt.Sprint(batches) != "[a\nb\n]" || failures != 3 {
+		t.Errorf("unexpected batches %q after %d writes", batches, failures)
+	}
+
+	var dropped string
+	w = NewBatchWriter(fw, BatchWriterConfig{
+		MaxRetries:   -1,
+		ErrorHandler: func(batch []byte, err error) { dropped = string(batch) },
+	})
+	w.Write([]byte("c\n"))
+	w.Close()
+	if dropped != "c\n" || w.Failed() != 1 {
+		t.Errorf("unexpected dropped batch %q and %d failed records", dropped, w.Failed())
+	}
+}
+
+// retryAfterError is a retryable error with the interval before the retry.
+type retryAfterError time.Duration
+
+func (e retryAfterError) Error() string             { return "retry later" }
+func (e retryAfterError) Retryable() bool           { return true }
+func (e retryAfterError) RetryAfter() time.Duration { return time.Duration(e) }
+
+func TestBatchWriterRetryAfter(t *testing.T) {
+	var writes int32
+	fw := WriterFunc(func(p []byte) (int, error) {
+		atomic.AddInt32(&writes, 1)
+		return 0, retryAfterError(time.Hour)
+	})
+
+	// The interval of RetryAfter is capped by MaxRetryInterval.
+	w := NewBatchWriter(fw, BatchWriterConfig{MaxRetries: 1, MaxRetryInterval: time.Millisecond})
+	w.Write([]byte("a\n"))
+	if err := w.Flush(); err != nil {
+		t.Error(err)
+	} else if n := atomic.LoadInt32(&writes); n != 2 || w.Failed() != 1 {
+		t.Errorf("unexpected %d writes and %d failed records", n, w.Failed())
+	}
+	w.Close()
+
+	// Close waits for the interval before the retry.
+	w = NewBatchWriter(fw, BatchWriterConfig{MaxRecords: 1, MaxRetries: 1,
+		MaxRetryInterval: time.Millisecond * 100})
+	w.Write([]byte("b\n"))
+	for i := 0; i < 100 && atomic.LoadInt32(&writes) < 3; i++ {
+		time.Sleep(time.Millisecond) // Wait until it fails for the first time.
+	}
+	start := time.Now()
+	if err := w.Close(); err != nil {
+		t.Error(err)
+	} else if cost := time.Since(start); cost < time.Millisecond*50 {
+		t.Errorf("Close does not wait for the retry interval: %s", cost)
+	} else if n := atomic.LoadInt32(&writes); n != 4 {
+		t.Errorf("expect 4 writes, but got %d", n)
+	}
+
+	// But no longer than DrainTimeout.
+	w = NewBatchWriter(fw, BatchWriterConfig{MaxRecords: 1, MaxRetries: 1,
+		DrainTimeout: time.Millisecond * 50})
+	w.Write([]byte("c\n"))
+	for i := 0; i < 100 && atomic.LoadInt32(&writes) < 5; i++ {
+		time.Sleep(time.Millisecond) // Wait until it fails for the first time.
+	}
+	start = time.Now()
+	if err := w.Close(); err != ErrBatchWriterTimeout {
+		t.Errorf("unexpected error: %v", err)
+	} else if cost := time.Since(start); cost > time.Second {
+		t.Errorf("Close does not honor DrainTimeout: %s", cost)
+	}
+	<-w.exited
+	if n := atomic.LoadInt32(&writes); n != 5 || w.Failed() != 1 {
+		t.Errorf("unexpected %d writes and %d failed records", n, w.Failed())
+	}
+}
+
+func TestBatchWriterCloseTimeout(t *testing.T) {
+	gw := &gateWriter{gate: make(chan struct{})}
+	var dropped []string
+	w := NewBatchWriter(gw, BatchWriterConfig{MaxRecords: 1, QueueSize: 1,
+		DrainTimeout: time.Millisecond * 50,
+		ErrorHandler: func(batch []byte, err error) {
+			dropped = append(dropped, fmt.Sprintf("%q: %v", batch, err))
+		}})
+	w.Write([]byte("a\n")) // Being written.
+	for i := 0; i < 100 && w.Queued() != 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	w.Write([]byte("b\n")) // Fill the queue.
+
+	blocked := make(chan error)
+	go func() { _, err := w.Write([]byte("c\n")); blocked <- err }()
+	time.Sleep(time.Millisecond * 10)
+
+	start := time.Now()
+	if err := w.Close(); err != ErrBatchWriterTimeout {
+		t.Errorf("unexpected error: %v", err)
+	} else if cost := time.Since(start); cost > time.Second {
+		t.Errorf("Close does not honor DrainTimeout: %s", cost)
+	}
+	if err := <-blocked; err != ErrBatchWriterClosed {
+		t.Errorf("unexpected error of the blocked write: %v", err)
+	}
+
+	// The queued batch is dropped, and only the batch being written is done.
+	if n := w.Queued(); n != 0 || w.Failed() != 1 {
+		t.Errorf("unexpected %d queued batches and %d failed records", n, w.Failed())
+	} else if fmt.Sprint(dropped) != `["b\n": timeout to drain the batch writer]` {
+		t.Errorf("unexpected dropped batches: %v", dropped)
+	}
+	close(gw.gate)
+	<-w.exited
+	if writes := gw.Writes(); fmt.Sprint(writes) != "[a\n]" {
+		t.Errorf("unexpected writes: %q", writes)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for i, d := range []time.Duration{1, 2, 4, 8, 10, 10} {
+		if v := backoff(1, 10, i); v != d {
+			t.Errorf("%d: expect %d, but got %d", i, d, v)
+		}
+	}
+}
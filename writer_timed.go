@@ -0,0 +1,444 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RotationInterval is the interval to rotate the log file by the time.
+type RotationInterval int
+
+// Predefine some rotation intervals.
+const (
+	RotateDaily RotationInterval = iota
+	RotateHourly
+	RotateMinutely
+)
+
+// start returns the start time of the interval which t is in.
+func (i RotationInterval) start(t time.Time) time.Time {
+	year, month, day := t.Date()
+	switch i {
+	case RotateMinutely:
+		return time.Date(year, month, day, t.Hour(), t.Minute(), 0, 0, t.Location())
+	case RotateHourly:
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, t.Location())
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	}
+}
+
+// next returns the start time of the next interval, and start must be
+// the result of the method start.
+func (i RotationInterval) next(start time.Time) time.Time {
+	switch i {
+	case RotateMinutely:
+		return start.Add(time.Minute)
+	case RotateHourly:
+		return start.Add(time.Hour)
+	default:
+		year, month, day := start.Date()
+		return time.Date(year, month, day+1, 0, 0, 0, 0, start.Location())
+	}
+}
+
+// TimedRotatingFileConfig is used to configure the timed rotating file writer.
+type TimedRotatingFileConfig struct {
+	// The interval to rotate the file, which is RotateDaily by default.
+	Interval RotationInterval
+
+	// The time zone to decide the boundary of the interval and to format
+	// the filename, which is time.Local by default.
+	Location *time.Location
+
+	// If not empty, it is a symbolic link which always points to the active
+	// log file, such as "app.log".
+	SymLink string
+
+	// If greater than 0, the file will also be rotated when its size exceeds
+	// MaxSize in the same interval, and the new file is named as the filename
+	// of the interval with the suffix ".N", such as "app-2019-05-16.log.1".
+	MaxSize int
+
+	// The permission of the log file, which is 0644 by default.
+	FileMode os.FileMode
+
+	// If not nil, the file is compressed by it in the background after
+	// rotating to the next file, such as "app-2019-05-16.log.gz".
+	Compressor FileCompressor
+
+	// If greater than 0, the log files modified before MaxAge ago are removed.
+	MaxAge time.Duration
+
+	// If greater than 0, the oldest log files are removed until the total
+	// size of all the log files is not greater than MaxTotalSize.
+	MaxTotalSize int64
+
+	// The clock to get the current time, which is DefaultClock by default.
+	Clock Clock
+
+	// If not nil, it is called when failing to link SymLink to the active
+	// file or to close the rotated file, which doesn't fail the write.
+	// The error is printed to os.Stderr by default.
+	ErrorHandler func(err error)
+}
+
+// TimedRotatingFileWriter returns a new file writer with rotating based on
+// the time, the filename of which is generated by the strftime-like pattern.
+//
+// The pattern supports the conversion specifications as follow:
+//
+//     %Y  The year as a decimal number with century, such as 2019.
+//     %y  The year as a decimal number without century (00-99).
+//     %m  The month as a decimal number (01-12).
+//     %d  The day of the month as a decimal number (01-31).
+//     %j  The day of the year as a decimal number (001-366).
+//     %H  The hour as a decimal number using a 24-hour clock (00-23).
+//     %M  The minute as a decimal number (00-59).
+//     %S  The second as a decimal number (00-59).
+//     %%  A literal '%'.
+//
+// The time used to format the filename is the start of the interval,
+// so "app-%Y-%m-%dT%H.log" with RotateHourly generates "app-2019-05-16T13.log"
+// for all the logs between 13:00 and 14:00. The directories in the filename
+// will be created if they do not exist.
+//
+// The retention policies, MaxAge and MaxTotalSize, are applied to the files
+// matching the pattern, the conversion specifications of which match the digits
+// of the same widths, with the optional suffixes of the size rotation and
+// the compression. They are applied when starting, and after every rotation
+// and compression.
+//
+// It is thread-safe for concurrent writes.
+//
+// Notice: like SizedRotatingFileWriter, the file writer has also implemented
+// the interfaces Flusher, Rotator and Reopener. And Close waits for
+// the background compression.
+func TimedRotatingFileWriter(pattern string, conf ...TimedRotatingFileConfig) (Writer, io.Closer, error) {
+	var c TimedRotatingFileConfig
+	if len(conf) > 0 {
+		c = conf[0]
+	}
+	if c.Location == nil {
+		c.Location = time.Local
+	}
+	if c.FileMode == 0 {
+		c.FileMode = 0644
+	}
+	if c.Clock == nil {
+		c.Clock = DefaultClock
+	}
+
+	w := &timedRotatingFile{
+		pattern:    pattern,
+		conf:       c,
+		compressor: newBackupCompressor(c.Compressor),
+		retention:  retention{MaxAge: c.MaxAge, MaxTotalSize: c.MaxTotalSize},
+	}
+	if err := w.open(c.Clock.Now()); err != nil {
+		return nil, nil, err
+	}
+	w.removeBackups(w.filename)
+	registerFileWriter(w)
+	return w, w, nil
+}
+
+// timedRotatingFile is a rotating logging handler based on the time.
+type timedRotatingFile struct {
+	sync.Mutex
+	file *os.File
+
+	conf     TimedRotatingFileConfig
+	pattern  string
+	basename string // The filename of the current interval without the suffix.
+	filename string // The filename of the active file.
+	sequence int
+	nbytes   int
+	next     time.Time
+
+	compressor *backupCompressor
+	retention  retention
+}
+
+func (f *timedRotatingFile) Close() (err error) {
+	unregisterFileWriter(f)
+	f.Lock()
+	if f.file != nil {
+		err = f.close()
+	}
+	f.Unlock()
+	f.compressor.Wait()
+	return
+}
+
+func (f *timedRotatingFile) Flush() (err error) {
+	f.Lock()
+	if f.file != nil {
+		err = f.file.Sync()
+	}
+	f.Unlock()
+	return
+}
+
+func (f *timedRotatingFile) Write(data []byte) (n int, err error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.file == nil {
+		return 0, errFileClosed
+	}
+
+	if now := f.conf.Clock.Now(); !now.Before(f.next) {
+		if err = f.rotate(func() error { return f.open(now) }); err != nil {
+			return
+		}
+	} else if f.conf.MaxSize > 0 && f.nbytes > 0 && f.nbytes+len(data) > f.conf.MaxSize {
+		if err = f.rotate(func() error { return f.openFile(f.sequence + 1) }); err != nil {
+			return
+		}
+	}
+
+	if n, err = f.file.Write(data); err != nil {
+		return
+	}
+
+	f.nbytes += n
+	return
+}
+
+// Rotate rotates to the next file immediately. If the current interval
+// has not ended, the next file is the filename of the interval with
+// the next sequence suffix, such as "app-2019-05-16.log.1".
+func (f *timedRotatingFile) Rotate() error {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.file == nil {
+		return errFileClosed
+	}
+
+	if now := f.conf.Clock.Now(); !now.Before(f.next) {
+		return f.rotate(func() error { return f.open(now) })
+	}
+	return f.rotate(func() error { return f.openFile(f.sequence + 1) })
+}
+
+// Reopen opens the active file by the filename again, then closes
+// the old one. If failing to open it, the old one is still used.
+func (f *timedRotatingFile) Reopen() (err error) {
+	f.Lock()
+	defer f.Unlock()
+
+	old := f.file
+	if old == nil {
+		return errFileClosed
+	}
+
+	err = f.openFile(f.sequence)
+	if f.file != old {
+		old.Close()
+	}
+	return
+}
+
+// rotate opens the next file by open, then closes the old file and
+// compresses it. If failing to open the next file, the old one is still used.
+func (f *timedRotatingFile) rotate(open func() error) (err error) {
+	old, filename := f.file, f.filename
+	basename, next := f.basename, f.next
+	if err = open(); err != nil {
+		f.basename, f.next = basename, next
+		return
+	}
+
+	if e := old.Close(); e != nil {
+		f.handleError(fmt.Errorf("Rotating: close failed: %s", e))
+	}
+	if f.filename != filename && fileIsExist(filename) {
+		active := f.filename
+		f.compressor.Compress(filename, func() { f.removeBackups(active) })
+	}
+	return
+}
+
+func (f *timedRotatingFile) handleError(err error) {
+	if f.conf.ErrorHandler != nil {
+		f.conf.ErrorHandler(err)
+	} else {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+// removeBackups removes the old log files by the retention policies.
+func (f *timedRotatingFile) removeBackups(active string) {
+	if f.retention.IsZero() {
+		return
+	}
+
+	// The later filename is generally newer.
+	glob := filenameGlob(f.pattern)
+	backups := globFiles(glob, glob+".*")
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	f.retention.Apply(backups, active, f.conf.Clock.Now())
+}
+
+// open opens the log file of the interval which now is in.
+func (f *timedRotatingFile) open(now time.Time) (err error) {
+	start := f.conf.Interval.start(now.In(f.conf.Location))
+	f.next = f.conf.Interval.next(start)
+	f.basename = formatFilename(f.pattern, start)
+
+	// Continue to write the last file of the interval when restarting,
+	// but never append to the file which has been compressed.
+	var sequence int
+	ext := f.compressor.Ext()
+	for f.fileExists(f.sequenceFilename(sequence+1), ext) {
+		sequence++
+	}
+	if ext != "" && fileIsExist(f.sequenceFilename(sequence)+ext) {
+		sequence++
+	} else if info, e := os.Stat(f.sequenceFilename(sequence)); e == nil &&
+		f.conf.MaxSize > 0 && info.Size() >= int64(f.conf.MaxSize) {
+		sequence++
+	}
+
+	return f.openFile(sequence)
+}
+
+func (f *timedRotatingFile) openFile(sequence int) (err error) {
+	filename := f.sequenceFilename(sequence)
+	if dir := filepath.Dir(filename); !fileIsExist(dir) {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return
+		}
+	}
+
+	file, err := os.OpenFile(filename, fileFlag, f.conf.FileMode)
+	if err != nil {
+		return
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return
+	}
+
+	f.file = file
+	f.filename = filename
+	f.sequence = sequence
+	f.nbytes = int(info.Size())
+
+	// The new file has been used, so don't fail the write because of the link.
+	if f.conf.SymLink != "" {
+		if e := f.link(); e != nil {
+			f.handleError(fmt.Errorf("Rotating: failed to link %s -> %s: %s",
+				f.conf.SymLink, filename, e))
+		}
+	}
+	return
+}
+
+func (f *timedRotatingFile) fileExists(filename, ext string) bool {
+	return fileIsExist(filename) || (ext != "" && fileIsExist(filename+ext))
+}
+
+func (f *timedRotatingFile) sequenceFilename(sequence int) string {
+	if sequence == 0 {
+		return f.basename
+	}
+	return f.basename + "." + strconv.Itoa(sequence)
+}
+
+// link points the symbolic link to the active file atomically, which creates
+// a temporary link and renames it to the symbolic link.
+func (f *timedRotatingFile) link() (err error) {
+	target := f.filename
+	if filepath.Dir(target) == filepath.Dir(f.conf.SymLink) {
+		target = filepath.Base(target)
+	} else if target, err = filepath.Abs(target); err != nil {
+		return
+	}
+
+	tmp := f.conf.SymLink + ".tmp"
+	os.Remove(tmp)
+	if err = os.Symlink(target, tmp); err != nil {
+		return
+	}
+	if err = os.Rename(tmp, f.conf.SymLink); err != nil {
+		os.Remove(tmp)
+	}
+	return
+}
+
+func (f *timedRotatingFile) close() (err error) {
+	err = f.file.Close()
+	f.file = nil
+	return
+}
+
+// formatFilename formats the time t by the strftime-like pattern.
+func formatFilename(pattern string, t time.Time) string {
+	buf := make([]byte, 0, len(pattern)+16)
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i+1 == len(pattern) {
+			buf = append(buf, pattern[i])
+			continue
+		}
+
+		i++
+		switch pattern[i] {
+		case 'Y':
+			buf = appendInt(buf, t.Year(), 4)
+		case 'y':
+			buf = appendInt(buf, t.Year()%100, 2)
+		case 'm':
+			buf = appendInt(buf, int(t.Month()), 2)
+		case 'd':
+			buf = appendInt(buf, t.Day(), 2)
+		case 'j':
+			buf = appendInt(buf, t.YearDay(), 3)
+		case 'H':
+			buf = appendInt(buf, t.Hour(), 2)
+		case 'M':
+			buf = appendInt(buf, t.Minute(), 2)
+		case 'S':
+			buf = appendInt(buf, t.Second(), 2)
+		case '%':
+			buf = append(buf, '%')
+		default:
+			buf = append(buf, '%', pattern[i])
+		}
+	}
+	return string(buf)
+}
+
+// appendInt appends the decimal integer i, which is padded with the leading
+// zeros to width.
+func appendInt(buf []byte, i, width int) []byte {
+	s := strconv.Itoa(i)
+	for n := len(s); n < width; n++ {
+		buf = append(buf, '0')
+	}
+	return append(buf, s...)
+}
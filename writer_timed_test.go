@@ -0,0 +1,161 @@
+// Copyright 2019 xgfone
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFormatFilename(t *testing.T) {
+	now := time.Date(2019, 5, 6, 7, 8, 9, 0, time.UTC)
+	if s := formatFilename("app-%Y%y-%m-%d-%j-%H%M%S-%%-%x.log", now); s != "app-201919-05-06-126-070809-%-%x.log" {
+		t.Error(s)
+	}
+}
+
+func TestTimedRotatingFileWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "timed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	loc := time.FixedZone("UTC+8", 8*3600)
+	now := time.Date(2019, 5, 16, 5, 59, 0, 0, time.UTC)
+	w, c, err := TimedRotatingFileWriter(filepath.Join(dir, "%Y%m%d", "app-%H.log"),
+		TimedRotatingFileConfig{
+			Interval: RotateHourly,
+			Location: loc,
+			SymLink:  filepath.Join(dir, "app.log"),
+			MaxSize:  8,
+			Clock:    ClockFunc(func() time.Time { return now }),
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.Write([]byte("abcd\n"))
+	w.Write([]byte("efgh\n")) // Exceed MaxSize.
+	now = now.Add(time.Minute)
+	w.Write([]byte("ijkl\n")) // Next hour.
+	w.(Flusher).Flush()
+
+	if link, err := os.Readlink(filepath.Join(dir, "app.log")); err != nil {
+		t.Error(err)
+	} else if link != filepath.Join(dir, "20190516", "app-14.log") {
+		t.Error(link)
+	}
+
+	c.Close()
+	if _, err = w.Write([]byte("mnop\n")); err == nil {
+		t.Error("expect an error after closed")
+	}
+
+	expects := map[string]string{
+		"app-13.log":   "abcd\n",
+		"app-13.log.1": "efgh\n",
+		"app-14.log":   "ijkl\n",
+	}
+	for name, expect := range expects {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "20190516", name))
+		if err != nil {
+			t.Error(err)
+		} else if string(data) != expect {
+			t.Errorf("%s: expect '%s', but got '%s'", name, expect, data)
+		}
+	}
+}
+
+func TestTimedRotatingFileWriterLinkError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "timed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var errs int
+	now := time.Date(2019, 5, 16, 5, 59, 0, 0, time.UTC)
+	w, c, err := TimedRotatingFileWriter(filepath.Join(dir, "app-%H.log"),
+		TimedRotatingFileConfig{
+			Interval:     RotateHourly,
+			Location:     time.UTC,
+			SymLink:      filepath.Join(dir, "missing", "app.log"),
+			Compressor:   GzipCompressor(),
+			Clock:        ClockFunc(func() time.Time { return now }),
+			ErrorHandler: func(error) { errs++ },
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.Write([]byte("abcd\n"))
+	now = now.Add(time.Minute)
+	if _, err = w.Write([]byte("efgh\n")); err != nil {
+		t.Error(err)
+	}
+	c.Close()
+
+	if errs != 2 {
+		t.Errorf("expect 2 errors, but got %d", errs)
+	}
+	if !fileIsExist(filepath.Join(dir, "app-05.log.gz")) {
+		t.Error("the rotated file is not compressed")
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "app-06.log")); string(data) != "efgh\n" {
+		t.Errorf("unexpected the active file: '%s'", data)
+	}
+}
+
+func TestTimedRotatingFileWriterRetention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "timed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	old := time.Now().Add(-time.Hour * 48)
+	for _, name := range []string{"app-01.log", "app-02.log.1.gz", "app-error.log", "other.log"} {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte("old\n"), 0644)
+		os.Chtimes(filepath.Join(dir, name), old, old)
+	}
+
+	if s := filenameGlob("app-%Y%j-%H[%%]%x*.log"); s != "app-[0-9][0-9][0-9][0-9][0-9][0-9][0-9]-[0-9][0-9][[]%]%x[*].log" {
+		t.Error(s)
+	}
+
+	_, c, err := TimedRotatingFileWriter(filepath.Join(dir, "app-%H.log"),
+		TimedRotatingFileConfig{
+			Interval: RotateHourly,
+			SymLink:  filepath.Join(dir, "app.log"),
+			MaxAge:   time.Hour * 24,
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	for name, exist := range map[string]bool{
+		"app-01.log": false, "app-02.log.1.gz": false,
+		"app-error.log": true, "other.log": true, "app.log": true,
+	} {
+		if fileIsExist(filepath.Join(dir, name)) != exist {
+			t.Errorf("%s: expect the existence %v", name, exist)
+		}
+	}
+}